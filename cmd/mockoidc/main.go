@@ -0,0 +1,31 @@
+// Command mockoidc is a minimal OpenID Connect provider for local
+// development. It signs in every authorization request as the configured
+// user without prompting, so the social login flow can be exercised end to
+// end against a provider entry such as:
+//
+//	{"name": "mock", "issuer": "http://127.0.0.1:9999", "client_id": "gotrock",
+//	 "redirect_url": "http://localhost:8080/auth/oidc/mock/callback"}
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/ardiannm/go/oidc/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:9999", "listen address")
+	email := flag.String("email", "mock.user@example.com", "email of the signed-in user")
+	givenName := flag.String("given-name", "Mock", "given name of the signed-in user")
+	familyName := flag.String("family-name", "User", "family name of the signed-in user")
+	flag.Parse()
+
+	s, err := oidctest.NewServer("http://"+*addr, *email, *givenName, *familyName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("mock OIDC provider at %s signing in %s", s.Issuer, s.Email)
+	log.Fatal(http.ListenAndServe(*addr, s))
+}
@@ -0,0 +1,37 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var registry = map[string]command{
+	"create-admin":        {usage: "create-admin <email>", run: createAdmin},
+	"ensure-indexes":      {usage: "ensure-indexes", run: ensureIndexes},
+	"purge-deleted-users": {usage: "purge-deleted-users", run: purgeDeletedUsers},
+}
+
+// Run executes the maintenance command named by args[0].
+func Run(args []string) error {
+	cmd, ok := registry[args[0]]
+	if !ok {
+		return errors.New("unknown command " + args[0] + "\n" + Usage())
+	}
+	return cmd.run(args[1:])
+}
+
+func Usage() string {
+	var lines []string
+	for _, cmd := range registry {
+		lines = append(lines, "  "+cmd.usage)
+	}
+	sort.Strings(lines)
+	return fmt.Sprintf("commands:\n%s", strings.Join(lines, "\n"))
+}
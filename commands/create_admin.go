@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ardiannm/go/database"
+	"github.com/ardiannm/go/models"
+	"github.com/ardiannm/go/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// createAdmin promotes an already registered account to ADMIN. It is the
+// only way to create the first admin, since registration never grants it.
+func createAdmin(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: create-admin <email>")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	users := database.OpenCollection("users")
+	var user models.User
+	err := users.FindOne(ctx, bson.M{"email": args[0]}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return fmt.Errorf("no user registered with email %s", args[0])
+	}
+	if err != nil {
+		return err
+	}
+	if user.HasRole(models.ADMIN) {
+		fmt.Printf("%s is already an admin\n", user.Email)
+		return nil
+	}
+	roles := append(user.RoleNames(), models.ADMIN)
+	update := bson.M{
+		"$set":   bson.M{"roles": roles, "updated_at": time.Now()},
+		"$unset": bson.M{"role": ""},
+	}
+	if _, err := users.UpdateOne(ctx, bson.M{"user_id": user.UserID}, update); err != nil {
+		return err
+	}
+	err = utils.RecordAuditEvent(models.AuditEvent{
+		Type:     "role.bootstrap",
+		TargetID: user.UserID,
+		Details:  bson.M{"previous_roles": user.RoleNames(), "roles": roles},
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s is now an admin; their tokens carry ADMIN once two-factor authentication is enabled\n", user.Email)
+	return nil
+}
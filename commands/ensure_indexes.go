@@ -0,0 +1,31 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ardiannm/go/utils"
+)
+
+// ensureIndexes creates the indexes the server would create on startup, for
+// deployments that build them ahead of a release.
+func ensureIndexes(args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: ensure-indexes")
+	}
+	ensured, err := utils.EnsureIndexes()
+	if err != nil {
+		return err
+	}
+	collections := make([]string, 0, len(ensured))
+	for collection := range ensured {
+		collections = append(collections, collection)
+	}
+	sort.Strings(collections)
+	for _, collection := range collections {
+		fmt.Printf("%s: %s\n", collection, strings.Join(ensured[collection], ", "))
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ardiannm/go/utils"
+)
+
+// purgeDeletedUsers runs the same purge the server runs periodically, for
+// deployments that prefer to schedule it externally.
+func purgeDeletedUsers(args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: purge-deleted-users")
+	}
+	purged, err := utils.PurgeDeletedAccounts()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("purged %d accounts\n", purged)
+	return nil
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"log"
 	"os"
 	"reflect"
@@ -9,7 +10,8 @@ import (
 	"github.com/joho/godotenv"
 )
 
-// Config holds all environment variables
+// Config holds all environment variables. Fields tagged with `default` are
+// optional and fall back to the tag value when the variable is not set.
 type Config struct {
 	MONGODB_URI        string
 	DATABASE_NAME      string
@@ -17,11 +19,81 @@ type Config struct {
 	PROMPT_TEMPLATE    string
 	SECRET_ACCESS_KEY  string
 	SECRET_REFRESH_KEY string
+	// JSON file describing the asymmetric JWT signing keys; when empty access
+	// tokens are HS256-signed with SECRET_ACCESS_KEY
+	JWT_KEYRING_FILE string `default:""`
+	// base URLs of the web client and of this API, used to build links sent by email
+	APP_BASE_URL string `default:"http://localhost:3000"`
+	API_BASE_URL string `default:"http://localhost:8080"`
+	// "smtp" or "log"; the log driver writes messages to MAIL_LOG_FILE or stdout
+	MAIL_DRIVER                string `default:"log"`
+	MAIL_FROM                  string `default:"Gotrock <no-reply@gotrock.local>"`
+	MAIL_LOG_FILE              string `default:""`
+	SMTP_HOST                  string `default:""`
+	SMTP_PORT                  string `default:"587"`
+	SMTP_USERNAME              string `default:""`
+	SMTP_PASSWORD              string `default:""`
+	PASSWORD_RESET_TTL_MINUTES int64  `default:"30"`
+	// when true LoginUser refuses accounts that have not confirmed their email
+	REQUIRE_EMAIL_VERIFICATION        bool  `default:"false"`
+	EMAIL_VERIFICATION_TTL_HOURS      int64 `default:"48"`
+	EMAIL_VERIFICATION_RESEND_SECONDS int64 `default:"60"`
+	// failed logins tolerated before lockout; each further failure doubles
+	// the lockout, starting at the base and capped at the max
+	LOGIN_MAX_FAILURES_PER_ACCOUNT int64 `default:"5"`
+	LOGIN_MAX_FAILURES_PER_IP      int64 `default:"20"`
+	LOGIN_FAILURE_WINDOW_MINUTES   int64 `default:"15"`
+	LOGIN_LOCKOUT_BASE_SECONDS     int64 `default:"30"`
+	LOGIN_LOCKOUT_MAX_SECONDS      int64 `default:"3600"`
+	// JSON file listing the OpenID Connect providers offered for social login
+	OIDC_PROVIDERS_FILE string `default:""`
+	// when true tokens travel in HttpOnly cookies guarded by a double-submit
+	// CSRF token instead of the response body
+	AUTH_COOKIES_ENABLED bool   `default:"false"`
+	COOKIE_DOMAIN        string `default:""`
+	COOKIE_SECURE        bool   `default:"true"`
+	// "lax", "strict" or "none"
+	COOKIE_SAMESITE string `default:"lax"`
+	// days between DELETE /users/me and the account being purged; signing in
+	// again before then cancels the deletion
+	ACCOUNT_DELETION_GRACE_DAYS int64 `default:"14"`
+	// how long a finished data export stays downloadable
+	DATA_EXPORT_TTL_HOURS int64 `default:"72"`
+	// password policy applied on registration, password change and reset
+	PASSWORD_MIN_LENGTH             int64 `default:"8"`
+	PASSWORD_MAX_BYTES              int64 `default:"72"`
+	PASSWORD_MIN_CHARACTER_CLASSES  int64 `default:"2"`
+	PASSWORD_DISALLOW_PERSONAL_INFO bool  `default:"true"`
+	// offline breached password list, one "SHA1:COUNT" line per password
+	// sorted by hash; passwords seen at least BREACHED_PASSWORD_MIN_COUNT
+	// times are refused
+	BREACHED_PASSWORDS_FILE     string `default:""`
+	BREACHED_PASSWORD_MIN_COUNT int64  `default:"1"`
+	// "bcrypt" or "argon2id"; stored hashes using another algorithm or other
+	// parameters are replaced on the next successful login
+	PASSWORD_HASH_ALGORITHM string `default:"bcrypt"`
+	BCRYPT_COST             int64  `default:"12"`
+	ARGON2_MEMORY_KIB       int64  `default:"65536"`
+	ARGON2_ITERATIONS       int64  `default:"3"`
+	ARGON2_PARALLELISM      int64  `default:"2"`
+	// lifetime of the tokens issued by POST /users/:user_id/impersonate
+	IMPERSONATION_TTL_MINUTES int64 `default:"15"`
+	// when true POST /users only accepts registrations with an invitation code
+	REQUIRE_INVITATION bool `default:"false"`
+	// mongo uses a text index; memory keeps an index in process for
+	// databases without text search
+	MOVIE_SEARCH_BACKEND         string `default:"mongo"`
+	MOVIE_SEARCH_REFRESH_SECONDS int64  `default:"60"`
+	// turn off to build indexes out of band with the ensure-indexes command
+	ENSURE_INDEXES_ON_STARTUP bool `default:"true"`
 }
 
 // Env is the global config instance
 var Env Config
 
+// missingEnvVariables lists the required variables init found unset
+var missingEnvVariables string
+
 func init() {
 	// Load .env (ignore if not found)
 	if err := godotenv.Load(".env"); err != nil {
@@ -31,20 +103,31 @@ func init() {
 	v := reflect.ValueOf(&Env).Elem()
 	t := v.Type()
 
-	var missingEnvVariables string
-
 	for i := 0; i < v.NumField(); i++ {
 		field := t.Field(i)
 		fieldValue := v.Field(i)
 
 		envVariableName := field.Name
 		value := os.Getenv(envVariableName)
+		defaultValue, optional := field.Tag.Lookup("default")
+		if value == "" && optional {
+			value = defaultValue
+			if value == "" {
+				continue
+			}
+		}
 
 		if value == "" {
 			missingEnvVariables += "❌ " + envVariableName + "\n"
 		} else {
 			if fieldValue.Kind() == reflect.String {
 				fieldValue.SetString(value)
+			} else if fieldValue.Kind() == reflect.Bool {
+				parsed, err := strconv.ParseBool(value)
+				if err != nil {
+					log.Fatalf("❌ Invalid value for %s: %s", envVariableName, value)
+				}
+				fieldValue.SetBool(parsed)
 			} else if fieldValue.Kind() == reflect.Int64 {
 				parsed, err := strconv.ParseInt(value, 10, 64)
 				if err != nil {
@@ -56,8 +139,14 @@ func init() {
 			}
 		}
 	}
+}
 
+// Validate reports the required variables that are not set. Loading does
+// not stop on them, so packages can be imported by tests that set Env
+// themselves; main calls Validate before anything else.
+func Validate() error {
 	if missingEnvVariables != "" {
-		log.Fatalf("Missing required environment variables:\n%s", missingEnvVariables)
+		return errors.New("Missing required environment variables:\n" + missingEnvVariables)
 	}
+	return nil
 }
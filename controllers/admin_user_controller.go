@@ -0,0 +1,303 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ardiannm/go/models"
+	"github.com/ardiannm/go/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// adminUserProjection loads only what AdminUserView shows. The password is
+// replaced by a marker so HasPassword still works without the hash ever
+// leaving the database.
+var adminUserProjection = bson.M{
+	"user_id":               1,
+	"first_name":            1,
+	"last_name":             1,
+	"email":                 1,
+	"email_verified":        1,
+	"roles":                 1,
+	"role":                  1,
+	"favourite_genres":      1,
+	"identities.provider":   1,
+	"two_factor.enabled":    1,
+	"created_at":            1,
+	"updated_at":            1,
+	"deletion_scheduled_at": 1,
+	"disabled_at":           1,
+	"disabled_reason":       1,
+	"password":              bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{"$password", ""}}, "set", ""}},
+}
+
+// userSortFields maps the accepted sort keys to document fields
+var userSortFields = map[string]string{
+	"created_at": "created_at",
+	"email":      "email",
+	"last_name":  "last_name",
+}
+
+// GetUsers lists accounts a page at a time. It accepts limit, cursor, sort
+// (created_at, email or last_name, "-" for descending), role, email (a case
+// insensitive prefix), created_after, created_before and status (active,
+// disabled or pending_deletion).
+func GetUsers() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		limit, err := utils.PageSize(ctx.Query("limit"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		sort := ctx.DefaultQuery("sort", "-created_at")
+		sortKey, descending := strings.CutPrefix(sort, "-")
+		sortField, ok := userSortFields[sortKey]
+		if !ok {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported sort", "allowed": []string{"created_at", "email", "last_name"}})
+			return
+		}
+		conditions := bson.A{}
+		if role := ctx.Query("role"); role != "" {
+			conditions = append(conditions, roleHolderFilter(models.UserRole(strings.ToUpper(role))))
+		}
+		if email := ctx.Query("email"); email != "" {
+			pattern := "^" + regexp.QuoteMeta(email)
+			conditions = append(conditions, bson.M{"email": bson.M{"$regex": pattern, "$options": "i"}})
+		}
+		for param, op := range map[string]string{"created_after": "$gte", "created_before": "$lt"} {
+			value := ctx.Query(param)
+			if value == "" {
+				continue
+			}
+			when, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": param + " must be an RFC 3339 timestamp"})
+				return
+			}
+			conditions = append(conditions, bson.M{"created_at": bson.M{op: when}})
+		}
+		switch ctx.Query("status") {
+		case "":
+		case "active":
+			conditions = append(conditions, bson.M{"disabled_at": nil, "deletion_scheduled_at": nil})
+		case "disabled":
+			conditions = append(conditions, bson.M{"disabled_at": bson.M{"$ne": nil}})
+		case "pending_deletion":
+			conditions = append(conditions, bson.M{"deletion_scheduled_at": bson.M{"$ne": nil}})
+		default:
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "status must be active, disabled or pending_deletion"})
+			return
+		}
+		if encoded := ctx.Query("cursor"); encoded != "" {
+			cursor, err := utils.DecodeCursor(encoded, sort)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			conditions = append(conditions, utils.AfterCursor(sortField, descending, cursor))
+		}
+		filter := bson.M{}
+		if len(conditions) > 0 {
+			filter["$and"] = conditions
+		}
+		direction := 1
+		if descending {
+			direction = -1
+		}
+		findOptions := options.Find().
+			SetProjection(adminUserProjection).
+			SetSort(bson.D{{Key: sortField, Value: direction}, {Key: "_id", Value: direction}}).
+			SetLimit(limit + 1)
+		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		cursor, err := userCollection.Find(mongoCtx, filter, findOptions)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+			return
+		}
+		defer cursor.Close(mongoCtx)
+		var users []models.User
+		if err = cursor.All(mongoCtx, &users); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode users", "reasons": err.Error()})
+			return
+		}
+		// one extra document is fetched to learn whether another page exists
+		var nextCursor string
+		if int64(len(users)) > limit {
+			users = users[:limit]
+			last := users[len(users)-1]
+			values := map[string]any{"created_at": bson.NewDateTimeFromTime(last.CreatedAt), "email": last.Email, "last_name": last.LastName}
+			nextCursor, err = utils.EncodeCursor(utils.PageCursor{Sort: sort, Value: values[sortKey], ID: last.ID})
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode cursor"})
+				return
+			}
+		}
+		views := make([]models.AdminUserView, 0, len(users))
+		for _, user := range users {
+			views = append(views, user.AdminView())
+		}
+		ctx.JSON(http.StatusOK, gin.H{"users": views, "next_cursor": nextCursor})
+	}
+}
+
+func GetUser() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		var user models.User
+		findOptions := options.FindOne().SetProjection(adminUserProjection)
+		err := userCollection.FindOne(mongoCtx, bson.M{"user_id": ctx.Param("user_id")}, findOptions).Decode(&user)
+		if err == mongo.ErrNoDocuments {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user", "reasons": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, user.AdminView())
+	}
+}
+
+// adminTarget resolves the :user_id an admin action applies to, refusing
+// actions on the admin's own account.
+func adminTarget(ctx *gin.Context) (string, string, bool) {
+	adminID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "User Id not found in context"})
+		return "", "", false
+	}
+	targetID := ctx.Param("user_id")
+	if targetID == adminID {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Admins cannot perform this action on their own account"})
+		return "", "", false
+	}
+	return adminID, targetID, true
+}
+
+func DisableUser() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		adminID, targetID, ok := adminTarget(ctx)
+		if !ok {
+			return
+		}
+		var req models.DisableUserRequest
+		if ctx.Request.ContentLength != 0 {
+			if err := ctx.ShouldBindJSON(&req); err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+				return
+			}
+		}
+		if err := validate.Struct(req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "reasons": err.Error()})
+			return
+		}
+		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		filter := bson.M{"user_id": targetID, "disabled_at": nil}
+		update := bson.M{"$set": bson.M{"disabled_at": time.Now(), "disabled_reason": req.Reason, "updated_at": time.Now()}}
+		result, err := userCollection.UpdateOne(mongoCtx, filter, update)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable user"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found or already disabled"})
+			return
+		}
+		if err := utils.RevokeAllUserTokens(targetID); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens", "reasons": err.Error()})
+			return
+		}
+		err = utils.RecordAuditEvent(models.AuditEvent{
+			Type:     "user.disable",
+			ActorID:  adminID,
+			TargetID: targetID,
+			IP:       ctx.ClientIP(),
+			Details:  bson.M{"reason": req.Reason},
+		})
+		if err != nil {
+			log.Println("Failed to record user disable:", err)
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "User disabled"})
+	}
+}
+
+func EnableUser() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		adminID, targetID, ok := adminTarget(ctx)
+		if !ok {
+			return
+		}
+		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		filter := bson.M{"user_id": targetID, "disabled_at": bson.M{"$ne": nil}}
+		update := bson.M{
+			"$unset": bson.M{"disabled_at": "", "disabled_reason": ""},
+			"$set":   bson.M{"updated_at": time.Now()},
+		}
+		result, err := userCollection.UpdateOne(mongoCtx, filter, update)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable user"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found or not disabled"})
+			return
+		}
+		err = utils.RecordAuditEvent(models.AuditEvent{
+			Type:     "user.enable",
+			ActorID:  adminID,
+			TargetID: targetID,
+			IP:       ctx.ClientIP(),
+		})
+		if err != nil {
+			log.Println("Failed to record user enable:", err)
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "User enabled"})
+	}
+}
+
+// DeleteUser erases an account immediately and answers with the erasure
+// record.
+func DeleteUser() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		adminID, targetID, ok := adminTarget(ctx)
+		if !ok {
+			return
+		}
+		record, err := utils.EraseUser(targetID, adminID, "deleted by an admin")
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user", "reasons": err.Error()})
+			return
+		}
+		if record == nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "User deleted", "erasure": record})
+	}
+}
+
+func GetErasureRecord() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		record, err := utils.FindErasureRecord(ctx.Param("erasure_id"))
+		if err == mongo.ErrNoDocuments {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Erasure record not found"})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch erasure record", "reasons": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, record)
+	}
+}
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ardiannm/go/database"
+	"github.com/ardiannm/go/models"
+	"github.com/ardiannm/go/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var apiKeyCollection *mongo.Collection = database.OpenCollection("api_keys")
+
+// requireSession refuses requests authenticated by an API key, so a leaked
+// key cannot be used to mint further keys, and requests made while
+// impersonating.
+func requireSession(ctx *gin.Context) bool {
+	if _, usingKey := ctx.Get("apiKeyId"); usingKey {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "This action requires a user session, not an API key"})
+		return false
+	}
+	return forbidImpersonation(ctx)
+}
+
+// forbidImpersonation refuses account-changing actions to admins acting as
+// someone else; impersonation is for looking, not for editing.
+func forbidImpersonation(ctx *gin.Context) bool {
+	if ctx.GetString("impersonatorId") != "" {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "This action is not allowed while impersonating"})
+		return false
+	}
+	return true
+}
+
+// apiKeyAttempts bounds how often CreateAPIKey draws a new key after a
+// prefix collision.
+const apiKeyAttempts = 3
+
+func CreateAPIKey() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !requireSession(ctx) {
+			return
+		}
+		userID, err := utils.GetUserIDFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "User Id not found in context"})
+			return
+		}
+		var req models.APIKeyRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "reasons": err.Error()})
+			return
+		}
+		scopes := []models.Permission{}
+		for _, scope := range req.Scopes {
+			if !scope.IsValid() {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope", "scope": scope})
+				return
+			}
+			scopes = append(scopes, scope)
+		}
+		apiKey := models.APIKey{
+			KeyID:     bson.NewObjectID().Hex(),
+			UserID:    userID,
+			Name:      req.Name,
+			Scopes:    scopes,
+			CreatedAt: time.Now(),
+		}
+		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		var key string
+		// prefixes are short enough to collide now and then; the unique
+		// index refuses the second one and a new key is drawn
+		for attempt := 1; ; attempt++ {
+			key, apiKey.Prefix, apiKey.KeyHash, err = utils.GenerateAPIKey()
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+				return
+			}
+			_, err = apiKeyCollection.InsertOne(mongoCtx, apiKey)
+			if err == nil {
+				break
+			}
+			if !utils.IsDuplicateKey(err) || attempt == apiKeyAttempts {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store API key", "reasons": err.Error()})
+				return
+			}
+		}
+		err = utils.RecordAuditEvent(models.AuditEvent{
+			Type:     "api_key.create",
+			ActorID:  userID,
+			TargetID: apiKey.KeyID,
+			IP:       ctx.ClientIP(),
+			Details:  bson.M{"prefix": apiKey.Prefix, "scopes": scopes},
+		})
+		if err != nil {
+			log.Println("Failed to record API key creation:", err)
+		}
+		// the plain key is only ever returned here
+		ctx.JSON(http.StatusCreated, gin.H{"key": key, "api_key": apiKey})
+	}
+}
+
+func GetAPIKeys() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, err := utils.GetUserIDFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "User Id not found in context"})
+			return
+		}
+		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+		cursor, err := apiKeyCollection.Find(mongoCtx, bson.M{"user_id": userID}, findOptions)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+			return
+		}
+		defer cursor.Close(mongoCtx)
+		apiKeys := []models.APIKey{}
+		if err := cursor.All(mongoCtx, &apiKeys); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode API keys", "reasons": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, apiKeys)
+	}
+}
+
+func RevokeAPIKey() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !requireSession(ctx) {
+			return
+		}
+		userID, err := utils.GetUserIDFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "User Id not found in context"})
+			return
+		}
+		keyID := ctx.Param("key_id")
+		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		filter := bson.M{"key_id": keyID, "user_id": userID, "revoked_at": bson.M{"$exists": false}}
+		result, err := apiKeyCollection.UpdateOne(mongoCtx, filter, bson.M{"$set": bson.M{"revoked_at": time.Now()}})
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+			return
+		}
+		err = utils.RecordAuditEvent(models.AuditEvent{
+			Type:     "api_key.revoke",
+			ActorID:  userID,
+			TargetID: keyID,
+			IP:       ctx.ClientIP(),
+		})
+		if err != nil {
+			log.Println("Failed to record API key revocation:", err)
+		}
+		ctx.JSON(http.StatusOK, gin.H{"revoked": true, "key_id": keyID})
+	}
+}
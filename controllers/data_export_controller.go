@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/ardiannm/go/models"
+	"github.com/ardiannm/go/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// queueDataExport starts an export of userID's data on behalf of the caller.
+func queueDataExport(ctx *gin.Context, userID, requestedBy string) {
+	export, err := utils.CreateDataExport(userID, requestedBy)
+	if err == utils.ErrExportInProgress {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue export", "reasons": err.Error()})
+		return
+	}
+	err = utils.RecordAuditEvent(models.AuditEvent{
+		Type:     "data.export_requested",
+		ActorID:  requestedBy,
+		TargetID: userID,
+		IP:       ctx.ClientIP(),
+		Details:  bson.M{"export_id": export.ExportID},
+	})
+	if err != nil {
+		log.Println("Failed to record export request:", err)
+	}
+	ctx.Header("Location", "/exports/"+export.ExportID)
+	ctx.JSON(http.StatusAccepted, export)
+}
+
+func RequestDataExport() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !requireSession(ctx) {
+			return
+		}
+		userID, err := utils.GetUserIDFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "User Id not found in context"})
+			return
+		}
+		queueDataExport(ctx, userID, userID)
+	}
+}
+
+func RequestUserDataExport() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		adminID, err := utils.GetUserIDFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "User Id not found in context"})
+			return
+		}
+		targetID := ctx.Param("user_id")
+		if _, err := findUserByID(targetID); err == mongo.ErrNoDocuments {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		} else if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user", "reasons": err.Error()})
+			return
+		}
+		queueDataExport(ctx, targetID, adminID)
+	}
+}
+
+// accessibleExport loads an export the caller may see: their own, or any
+// export when they manage users. Others get a 404 rather than a 403 so export
+// ids cannot be probed.
+func accessibleExport(ctx *gin.Context, withArchive bool) (models.DataExport, bool) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "User Id not found in context"})
+		return models.DataExport{}, false
+	}
+	export, err := utils.FindDataExport(ctx.Param("export_id"), withArchive)
+	if err != nil && err != mongo.ErrNoDocuments {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch export", "reasons": err.Error()})
+		return export, false
+	}
+	permissions, _ := utils.GetPermissionsFromContext(ctx)
+	if err == mongo.ErrNoDocuments || (export.UserID != userID && !slices.Contains(permissions, models.PermUsersManage)) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return export, false
+	}
+	return export, true
+}
+
+func GetDataExport() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		export, ok := accessibleExport(ctx, false)
+		if !ok {
+			return
+		}
+		ctx.JSON(http.StatusOK, export)
+	}
+}
+
+// DownloadDataExport serves a finished export as the ZIP archive, or with
+// ?format=json as the bare export.json inside it.
+func DownloadDataExport() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		export, ok := accessibleExport(ctx, true)
+		if !ok {
+			return
+		}
+		if export.Status != models.ExportReady {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Export is not ready", "status": export.Status})
+			return
+		}
+		name := "gotrock-export-" + export.ExportID
+		switch ctx.DefaultQuery("format", "zip") {
+		case "zip":
+			ctx.Header("Content-Disposition", `attachment; filename="`+name+`.zip"`)
+			ctx.Data(http.StatusOK, "application/zip", export.Archive)
+		case "json":
+			document, err := readArchiveFile(export.Archive, utils.ExportFileName)
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read export", "reasons": err.Error()})
+				return
+			}
+			ctx.Header("Content-Disposition", `attachment; filename="`+name+`.json"`)
+			ctx.Data(http.StatusOK, "application/json", document)
+		default:
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "format must be zip or json"})
+		}
+	}
+}
+
+func readArchiveFile(archive []byte, name string) ([]byte, error) {
+	reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, err
+	}
+	file, err := reader.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
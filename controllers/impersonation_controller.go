@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ardiannm/go/config"
+	"github.com/ardiannm/go/models"
+	"github.com/ardiannm/go/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// ImpersonateUser issues a short-lived token that lets an admin see the API
+// as the given user. The token is marked as an impersonation token, carries
+// both user ids, cannot be refreshed and cannot change the account; every
+// request made with it is audited by ImpersonationAuditMiddleware.
+func ImpersonateUser() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !requireSession(ctx) {
+			return
+		}
+		adminID, targetID, ok := adminTarget(ctx)
+		if !ok {
+			return
+		}
+		var req models.ImpersonationRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "reasons": err.Error()})
+			return
+		}
+		target, err := findUserByID(targetID)
+		if err == mongo.ErrNoDocuments {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user", "reasons": err.Error()})
+			return
+		}
+		// acting as another admin would hand out their privileges
+		if target.HasRole(models.ADMIN) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Admins cannot be impersonated"})
+			return
+		}
+		if target.DisabledAt != nil || target.DeletionScheduledAt != nil {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Account is not active"})
+			return
+		}
+		roles := utils.EffectiveRoles(target)
+		permissions, err := utils.ResolvePermissions(roles)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions", "reasons": err.Error()})
+			return
+		}
+		sessionID := utils.NewSessionID()
+		expiresAt := time.Now().Add(time.Duration(config.Env.IMPERSONATION_TTL_MINUTES) * time.Minute)
+		token, err := utils.GenerateImpersonationToken(target.Email, target.FirstName, target.LastName, target.UserID, roles, permissions, sessionID, adminID, expiresAt)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token", "reasons": err.Error()})
+			return
+		}
+		if err := utils.CreateImpersonationSession(ctx, target.UserID, adminID, sessionID, expiresAt); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session", "reasons": err.Error()})
+			return
+		}
+		err = utils.RecordAuditEvent(models.AuditEvent{
+			Type:     "impersonation.start",
+			ActorID:  adminID,
+			TargetID: target.UserID,
+			IP:       ctx.ClientIP(),
+			Details:  bson.M{"reason": req.Reason, "session_id": sessionID, "expires_at": expiresAt},
+		})
+		if err != nil {
+			log.Println("Failed to record impersonation:", err)
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"token":           token,
+			"token_use":       utils.TokenUseImpersonation,
+			"user_id":         target.UserID,
+			"impersonator_id": adminID,
+			"session_id":      sessionID,
+			"expires_at":      expiresAt,
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ardiannm/go/database"
+	"github.com/ardiannm/go/models"
+	"github.com/ardiannm/go/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var invitationCollection *mongo.Collection = database.OpenCollection("invitations")
+
+func CreateInvitation() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		adminID, err := utils.GetUserIDFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "User Id not found in context"})
+			return
+		}
+		var req models.InvitationRequest
+		if ctx.Request.ContentLength != 0 {
+			if err := ctx.ShouldBindJSON(&req); err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+				return
+			}
+		}
+		if err := validate.Struct(req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "reasons": err.Error()})
+			return
+		}
+		if req.Role != "" {
+			// pre-assigning a role grants it, so it takes the same permission
+			// as granting it directly
+			permissions, _ := utils.GetPermissionsFromContext(ctx)
+			if !slices.Contains(permissions, models.PermRolesManage) {
+				ctx.JSON(http.StatusForbidden, gin.H{"error": "Pre-assigning a role requires " + string(models.PermRolesManage)})
+				return
+			}
+			role, err := findRole(req.Role)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role", "role": req.Role})
+				return
+			}
+			if !canHandOut(ctx, rolePermissions(role)) {
+				return
+			}
+		}
+		if req.MaxUses == 0 {
+			req.MaxUses = 1
+		}
+		if req.ExpiresInHours == 0 {
+			req.ExpiresInHours = 7 * 24
+		}
+		code, codeHash, err := utils.GenerateSecureToken()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate invitation code"})
+			return
+		}
+		invitation := models.Invitation{
+			InvitationID: bson.NewObjectID().Hex(),
+			CodeHash:     codeHash,
+			CreatedBy:    adminID,
+			Email:        strings.ToLower(req.Email),
+			Role:         req.Role,
+			MaxUses:      req.MaxUses,
+			Redemptions:  []models.InvitationRedemption{},
+			CreatedAt:    time.Now(),
+			ExpiresAt:    time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour),
+		}
+		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if _, err := invitationCollection.InsertOne(mongoCtx, invitation); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store invitation", "reasons": err.Error()})
+			return
+		}
+		err = utils.RecordAuditEvent(models.AuditEvent{
+			Type:     "invitation.create",
+			ActorID:  adminID,
+			TargetID: invitation.InvitationID,
+			IP:       ctx.ClientIP(),
+			Details:  bson.M{"email": invitation.Email, "role": invitation.Role, "max_uses": invitation.MaxUses},
+		})
+		if err != nil {
+			log.Println("Failed to record invitation creation:", err)
+		}
+		// the plain code is only ever returned here
+		ctx.JSON(http.StatusCreated, gin.H{"code": code, "invitation": invitation})
+	}
+}
+
+func GetInvitations() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		findOptions := options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}}).
+			SetProjection(bson.M{"code_hash": 0, "redemptions": 0})
+		cursor, err := invitationCollection.Find(mongoCtx, bson.M{}, findOptions)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invitations"})
+			return
+		}
+		defer cursor.Close(mongoCtx)
+		invitations := []models.Invitation{}
+		if err := cursor.All(mongoCtx, &invitations); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode invitations", "reasons": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, invitations)
+	}
+}
+
+func RevokeInvitation() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		adminID, err := utils.GetUserIDFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "User Id not found in context"})
+			return
+		}
+		invitationID := ctx.Param("invitation_id")
+		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		filter := bson.M{"invitation_id": invitationID, "revoked_at": bson.M{"$exists": false}}
+		result, err := invitationCollection.UpdateOne(mongoCtx, filter, bson.M{"$set": bson.M{"revoked_at": time.Now()}})
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invitation"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+			return
+		}
+		err = utils.RecordAuditEvent(models.AuditEvent{
+			Type:     "invitation.revoke",
+			ActorID:  adminID,
+			TargetID: invitationID,
+			IP:       ctx.ClientIP(),
+		})
+		if err != nil {
+			log.Println("Failed to record invitation revocation:", err)
+		}
+		ctx.JSON(http.StatusOK, gin.H{"revoked": true, "invitation_id": invitationID})
+	}
+}
+
+func GetInvitationRedemptions() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		var invitation models.Invitation
+		err := invitationCollection.FindOne(mongoCtx, bson.M{"invitation_id": ctx.Param("invitation_id")}).Decode(&invitation)
+		if err == mongo.ErrNoDocuments {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invitation"})
+			return
+		}
+		redemptions := invitation.Redemptions
+		if redemptions == nil {
+			redemptions = []models.InvitationRedemption{}
+		}
+		ctx.JSON(http.StatusOK, gin.H{"invitation_id": invitation.InvitationID, "uses": invitation.Uses, "max_uses": invitation.MaxUses, "redemptions": redemptions})
+	}
+}
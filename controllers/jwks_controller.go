@@ -0,0 +1,15 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/ardiannm/go/utils"
+	"github.com/gin-gonic/gin"
+)
+
+func GetJWKS() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Header("Cache-Control", "public, max-age=300")
+		ctx.JSON(http.StatusOK, utils.GetPublicJWKS())
+	}
+}
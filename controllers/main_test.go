@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ardiannm/go/config"
+	"github.com/ardiannm/go/database"
+	"github.com/ardiannm/go/utils"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	// tokens come back in the body, and cookies work over plain HTTP
+	config.Env.AUTH_COOKIES_ENABLED = false
+	config.Env.COOKIE_SECURE = false
+	config.Env.REQUIRE_EMAIL_VERIFICATION = false
+	os.Exit(m.Run())
+}
+
+// requireDatabase skips tests that read and write MongoDB unless they run
+// with the server's environment, which should name a scratch DATABASE_NAME.
+func requireDatabase(t *testing.T) {
+	t.Helper()
+	if err := config.Validate(); err != nil {
+		t.Skip("needs the environment the server runs with:", err)
+	}
+	if err := database.Ping(); err != nil {
+		t.Skip("needs a MongoDB server:", err)
+	}
+	if err := utils.EnsureDefaultRoles(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,9 +1,14 @@
 package controllers
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -24,22 +29,154 @@ var rankingCollection *mongo.Collection = database.OpenCollection("rankings")
 
 var validate = validator.New()
 
+// movieSortFields maps the accepted sort keys to document fields
+var movieSortFields = map[string]string{
+	"title":         "title",
+	"imdb_id":       "imdb_id",
+	"ranking_value": "ranking.ranking_value",
+}
+
+// GetMovies lists the catalogue a page at a time. It accepts limit, cursor,
+// sort (title, imdb_id or ranking_value, "-" for descending), genre (a genre
+// name, repeatable), ranking_name, ranking_min, ranking_max, title (a case
+// insensitive prefix) and count=true to include the total number of matches.
 func GetMovies() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
+		limit, err := utils.PageSize(ctx.Query("limit"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		sort := ctx.DefaultQuery("sort", "title")
+		sortKey, descending := strings.CutPrefix(sort, "-")
+		sortField, ok := movieSortFields[sortKey]
+		if !ok {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported sort", "allowed": []string{"title", "imdb_id", "ranking_value"}})
+			return
+		}
+		conditions := bson.A{}
+		if genres := ctx.QueryArray("genre"); len(genres) > 0 {
+			conditions = append(conditions, bson.M{"genre.genre_name": bson.M{"$in": genres}})
+		}
+		if rankingName := ctx.Query("ranking_name"); rankingName != "" {
+			conditions = append(conditions, bson.M{"ranking.ranking_name": rankingName})
+		}
+		for param, op := range map[string]string{"ranking_min": "$gte", "ranking_max": "$lte"} {
+			value := ctx.Query(param)
+			if value == "" {
+				continue
+			}
+			ranking, err := strconv.Atoi(value)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": param + " must be an integer"})
+				return
+			}
+			conditions = append(conditions, bson.M{"ranking.ranking_value": bson.M{op: ranking}})
+		}
+		if title := ctx.Query("title"); title != "" {
+			pattern := "^" + regexp.QuoteMeta(title)
+			conditions = append(conditions, bson.M{"title": bson.M{"$regex": pattern, "$options": "i"}})
+		}
+		withCount := false
+		if value := ctx.Query("count"); value != "" {
+			withCount, err = strconv.ParseBool(value)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "count must be true or false"})
+				return
+			}
+		}
 		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
-		var movies []models.Movie
-		cursor, err := movieCollection.Find(mongoCtx, bson.M{})
+		response := gin.H{}
+		if withCount {
+			// the total covers every page, so it is counted before the cursor
+			// narrows the filter
+			countFilter := bson.M{}
+			if len(conditions) > 0 {
+				countFilter["$and"] = conditions
+			}
+			total, err := movieCollection.CountDocuments(mongoCtx, countFilter)
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count movies"})
+				return
+			}
+			response["total"] = total
+		}
+		if encoded := ctx.Query("cursor"); encoded != "" {
+			cursor, err := utils.DecodeCursor(encoded, sort)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			conditions = append(conditions, utils.AfterCursor(sortField, descending, cursor))
+		}
+		filter := bson.M{}
+		if len(conditions) > 0 {
+			filter["$and"] = conditions
+		}
+		direction := 1
+		if descending {
+			direction = -1
+		}
+		findOptions := options.Find().
+			SetSort(bson.D{{Key: sortField, Value: direction}, {Key: "_id", Value: direction}}).
+			SetLimit(limit + 1)
+		cursor, err := movieCollection.Find(mongoCtx, filter, findOptions)
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch movies"})
 			return
 		}
 		defer cursor.Close(mongoCtx)
+		movies := []models.Movie{}
 		if err = cursor.All(mongoCtx, &movies); err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode movies", "reasons": err.Error()})
 			return
 		}
-		ctx.JSON(http.StatusOK, movies)
+		// one extra document is fetched to learn whether another page exists
+		var nextCursor string
+		if int64(len(movies)) > limit {
+			movies = movies[:limit]
+			last := movies[len(movies)-1]
+			values := map[string]any{"title": last.Title, "imdb_id": last.ImdbID, "ranking_value": last.Ranking.RankingValue}
+			nextCursor, err = utils.EncodeCursor(utils.PageCursor{Sort: sort, Value: values[sortKey], ID: last.ID})
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode cursor"})
+				return
+			}
+		}
+		utils.SetPageLinks(ctx, nextCursor)
+		response["movies"] = movies
+		response["next_cursor"] = nextCursor
+		ctx.JSON(http.StatusOK, response)
+	}
+}
+
+// SearchMovies ranks movies by how well their title and admin review match
+// q. Words tolerate small typos, word* matches a prefix and "quoted words"
+// match a phrase; every part of q must match.
+func SearchMovies() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		q := ctx.Query("q")
+		if len(q) > 200 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Search query is too long"})
+			return
+		}
+		query, err := utils.ParseSearchQuery(q)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		limit, err := utils.PageSize(ctx.Query("limit"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		results, err := utils.SearchMovies(query, int(limit))
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search movies", "reasons": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"results": results})
 	}
 }
 
@@ -58,6 +195,12 @@ func GetMovie() gin.HandlerFunc {
 			ctx.JSON(http.StatusNotFound, gin.H{"error": "Movie not found"})
 			return
 		}
+		etag := utils.VersionETag(movie.Version)
+		ctx.Header("ETag", etag)
+		if utils.ETagMatches(ctx.GetHeader("If-None-Match"), etag, true) {
+			ctx.Status(http.StatusNotModified)
+			return
+		}
 		ctx.JSON(http.StatusOK, movie)
 	}
 }
@@ -75,15 +218,171 @@ func AddMovie() gin.HandlerFunc {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "reasons": err.Error()})
 			return
 		}
+		movie.Version = 1
 		result, err := movieCollection.InsertOne(mongoCtx, movie)
+		if utils.IsDuplicateKey(err) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "A movie with this IMDb ID already exists"})
+			return
+		}
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add movie.", "reasons": err.Error()})
 			return
 		}
+		ctx.Header("ETag", utils.VersionETag(movie.Version))
 		ctx.JSON(http.StatusCreated, result)
 	}
 }
 
+// maxMovieBodyBytes bounds the body of movie updates
+const maxMovieBodyBytes = 1 << 20
+
+// movieVersionFilter selects the movie only while it is still at version.
+func movieVersionFilter(id bson.ObjectID, version int64) bson.M {
+	if version == 0 {
+		// movies stored before versioning have no version field
+		return bson.M{"_id": id, "version": bson.M{"$in": bson.A{0, nil}}}
+	}
+	return bson.M{"_id": id, "version": version}
+}
+
+// movieUnchanged checks the If-Match header against the movie's ETag. Edits
+// must name the version they were based on, so two editors cannot silently
+// overwrite each other.
+func movieUnchanged(ctx *gin.Context, movie models.Movie) bool {
+	header := ctx.GetHeader("If-Match")
+	if header == "" {
+		ctx.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header with the movie's ETag is required"})
+		return false
+	}
+	etag := utils.VersionETag(movie.Version)
+	if !utils.ETagMatches(header, etag, false) {
+		ctx.Header("ETag", etag)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"error": "Movie has changed since it was read", "etag": etag})
+		return false
+	}
+	return true
+}
+
+// saveMovie validates updated and stores it in place of current. The
+// imdb_id in the URL is the movie's identity and cannot be changed.
+func saveMovie(ctx *gin.Context, current, updated models.Movie) {
+	if updated.ImdbID != current.ImdbID || (!updated.ID.IsZero() && updated.ID != current.ID) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "imdb_id and _id cannot be changed"})
+		return
+	}
+	updated.ID = current.ID
+	updated.Version = current.Version + 1
+	if err := validate.Struct(updated); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "reasons": err.Error()})
+		return
+	}
+	mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	result, err := movieCollection.ReplaceOne(mongoCtx, movieVersionFilter(current.ID, current.Version), updated)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update movie", "reasons": err.Error()})
+		return
+	}
+	if result.MatchedCount == 0 {
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"error": "Movie has changed since it was read"})
+		return
+	}
+	ctx.Header("ETag", utils.VersionETag(updated.Version))
+	ctx.JSON(http.StatusOK, updated)
+}
+
+func findMovie(ctx *gin.Context) (models.Movie, bool) {
+	mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var movie models.Movie
+	err := movieCollection.FindOne(mongoCtx, bson.M{"imdb_id": ctx.Param("imdb_id")}).Decode(&movie)
+	if err == mongo.ErrNoDocuments {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Movie not found"})
+		return movie, false
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch movie"})
+		return movie, false
+	}
+	return movie, true
+}
+
+// decodeMovie reads a complete movie, refusing fields models.Movie does not
+// have so typos are not silently dropped.
+func decodeMovie(data []byte) (models.Movie, error) {
+	var movie models.Movie
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&movie)
+	return movie, err
+}
+
+// ReplaceMovie replaces every field of a movie with the request body. The
+// imdb_id may be left out of the body; version is set by the server.
+func ReplaceMovie() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		body, err := io.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxMovieBodyBytes))
+		if err != nil {
+			ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body is too large"})
+			return
+		}
+		updated, err := decodeMovie(body)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "reasons": err.Error()})
+			return
+		}
+		current, ok := findMovie(ctx)
+		if !ok || !movieUnchanged(ctx, current) {
+			return
+		}
+		if updated.ImdbID == "" {
+			updated.ImdbID = current.ImdbID
+		}
+		saveMovie(ctx, current, updated)
+	}
+}
+
+// PatchMovie applies an RFC 7396 merge patch or an RFC 6902 JSON Patch,
+// chosen by Content-Type, and validates the result like a new movie.
+func PatchMovie() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		contentType := ctx.ContentType()
+		if contentType != utils.MergePatchContentType && contentType != utils.JSONPatchContentType {
+			ctx.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Unsupported patch format", "accepted": []string{utils.MergePatchContentType, utils.JSONPatchContentType}})
+			return
+		}
+		patch, err := io.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxMovieBodyBytes))
+		if err != nil {
+			ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body is too large"})
+			return
+		}
+		current, ok := findMovie(ctx)
+		if !ok || !movieUnchanged(ctx, current) {
+			return
+		}
+		document, err := json.Marshal(current)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode movie"})
+			return
+		}
+		if contentType == utils.MergePatchContentType {
+			document, err = utils.ApplyMergePatch(document, patch)
+		} else {
+			document, err = utils.ApplyJSONPatch(document, patch)
+		}
+		if err != nil {
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Patch could not be applied", "reasons": err.Error()})
+			return
+		}
+		updated, err := decodeMovie(document)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Patched movie is invalid", "reasons": err.Error()})
+			return
+		}
+		saveMovie(ctx, current, updated)
+	}
+}
+
 func DeleteMovieByIMDBID() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -93,17 +392,30 @@ func DeleteMovieByIMDBID() gin.HandlerFunc {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Movie ID required"})
 			return
 		}
-		result, err := movieCollection.DeleteOne(mongoCtx, bson.M{"imdb_id": movieID})
+		var movie models.Movie
+		err := movieCollection.FindOne(mongoCtx, bson.M{"imdb_id": movieID}).Decode(&movie)
+		if err == mongo.ErrNoDocuments {
+			ctx.JSON(http.StatusOK, gin.H{
+				"deleted":       false,
+				"deleted_count": 0,
+				"message":       "No movie found with the provided IMDb ID.",
+			})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !movieUnchanged(ctx, movie) {
+			return
+		}
+		result, err := movieCollection.DeleteOne(mongoCtx, movieVersionFilter(movie.ID, movie.Version))
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 		if result.DeletedCount == 0 {
-			ctx.JSON(http.StatusOK, gin.H{
-				"deleted":       false,
-				"deleted_count": result.DeletedCount,
-				"message":       "No movie found with the provided IMDb ID.",
-			})
+			ctx.JSON(http.StatusPreconditionFailed, gin.H{"error": "Movie has changed since it was read"})
 			return
 		}
 		ctx.JSON(http.StatusOK, gin.H{
@@ -132,12 +444,17 @@ func AdminReviewUpdate() gin.HandlerFunc {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 			return
 		}
+		// the precondition is checked before the ranking is worked out
+		current, ok := findMovie(ctx)
+		if !ok || !movieUnchanged(ctx, current) {
+			return
+		}
 		sentiment, rankingValue, err := GetReviewRanking(req.AdminReview)
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Couldn't get review ranking", "reasons": err.Error()})
 			return
 		}
-		filter := bson.M{"imdb_id": IMDb_ID}
+		filter := movieVersionFilter(current.ID, current.Version)
 		var mongoCtx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 		update := bson.M{
@@ -145,6 +462,7 @@ func AdminReviewUpdate() gin.HandlerFunc {
 				RankingValue: rankingValue,
 				RankingName:  sentiment,
 			},
+			"$inc": bson.M{"version": 1},
 		}
 		result, err := movieCollection.UpdateOne(mongoCtx, filter, update)
 		if err != nil {
@@ -152,9 +470,10 @@ func AdminReviewUpdate() gin.HandlerFunc {
 			return
 		}
 		if result.MatchedCount == 0 {
-			ctx.JSON(http.StatusNotFound, gin.H{"error": "Movie not found"})
+			ctx.JSON(http.StatusPreconditionFailed, gin.H{"error": "Movie has changed since it was read"})
 			return
 		}
+		ctx.Header("ETag", utils.VersionETag(current.Version+1))
 		res.RankingName = sentiment
 		res.AdminReview = req.AdminReview
 		ctx.JSON(http.StatusOK, res)
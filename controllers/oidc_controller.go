@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ardiannm/go/models"
+	"github.com/ardiannm/go/oidc"
+	"github.com/ardiannm/go/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// oidcStateLifetime is how long the user has to sign in at the provider.
+const oidcStateLifetime = 10 * time.Minute
+
+func OIDCLogin() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		provider, ok := oidc.Providers[ctx.Param("provider")]
+		if !ok {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+			return
+		}
+		state, err := oidc.RandomString()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+			return
+		}
+		nonce, err := oidc.RandomString()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+			return
+		}
+		verifier, err := oidc.RandomString()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+			return
+		}
+		err = utils.SaveOIDCState(models.OIDCState{
+			State:        state,
+			Provider:     provider.Name,
+			Nonce:        nonce,
+			CodeVerifier: verifier,
+			ExpiresAt:    time.Now().Add(oidcStateLifetime),
+		})
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login", "reasons": err.Error()})
+			return
+		}
+		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		authURL, err := provider.AuthCodeURL(mongoCtx, state, nonce, oidc.CodeChallenge(verifier))
+		if err != nil {
+			ctx.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable", "reasons": err.Error()})
+			return
+		}
+		utils.SetOIDCStateCookie(ctx, state, oidcStateLifetime)
+		ctx.Redirect(http.StatusFound, authURL)
+	}
+}
+
+func OIDCCallback() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		provider, ok := oidc.Providers[ctx.Param("provider")]
+		if !ok {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+			return
+		}
+		if providerError := ctx.Query("error"); providerError != "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Login was not completed", "reasons": providerError + " " + ctx.Query("error_description")})
+			return
+		}
+		code, state := ctx.Query("code"), ctx.Query("state")
+		if code == "" || state == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "code and state are required"})
+			return
+		}
+		// the state alone does not prove this browser started the login
+		if !utils.ConsumeOIDCStateCookie(ctx, state) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Login was not started from this browser or has expired"})
+			return
+		}
+		pending, err := utils.ConsumeOIDCState(state, provider.Name)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Login request is unknown or has expired"})
+			return
+		}
+		requestCtx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		rawIDToken, err := provider.Exchange(requestCtx, code, pending.CodeVerifier)
+		if err != nil {
+			ctx.JSON(http.StatusBadGateway, gin.H{"error": "Failed to exchange authorization code", "reasons": err.Error()})
+			return
+		}
+		claims, err := provider.VerifyIDToken(requestCtx, rawIDToken, pending.Nonce)
+		if err != nil {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid ID token", "reasons": err.Error()})
+			return
+		}
+		user, status, err := userForIdentity(provider.Name, claims)
+		if err != nil {
+			ctx.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		finishPrimaryLogin(ctx, user)
+	}
+}
+
+// userForIdentity finds the user already linked to the external identity,
+// links an existing user who verified the same email, or creates a new USER
+// account.
+func userForIdentity(provider string, claims *oidc.IDTokenClaims) (models.User, int, error) {
+	mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var user models.User
+	filter := bson.M{"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": claims.Subject}}}
+	err := userCollection.FindOne(mongoCtx, filter).Decode(&user)
+	if err == nil {
+		return user, http.StatusOK, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return user, http.StatusInternalServerError, errors.New("Failed to look up user")
+	}
+	if claims.Email == "" || !claims.IsEmailVerified() {
+		return user, http.StatusForbidden, errors.New("The identity provider did not supply a verified email address")
+	}
+	identity := models.ExternalIdentity{
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+		LinkedAt: time.Now(),
+	}
+	err = userCollection.FindOne(mongoCtx, bson.M{"email": claims.Email}).Decode(&user)
+	if err == nil {
+		// anyone can register an address they do not own; linking such an
+		// account would hand its password holder the provider's login
+		if !user.EmailVerified {
+			return user, http.StatusConflict, errors.New("An account with this email exists but has not verified it; sign in with its password and verify the email first")
+		}
+		update := bson.M{
+			"$push": bson.M{"identities": identity},
+			"$set":  bson.M{"updated_at": time.Now()},
+		}
+		result, err := userCollection.UpdateOne(mongoCtx, bson.M{"user_id": user.UserID, "email_verified": true}, update)
+		if err != nil {
+			return user, http.StatusInternalServerError, errors.New("Failed to link identity")
+		}
+		if result.MatchedCount == 0 {
+			return user, http.StatusConflict, errors.New("Account changed concurrently, please retry")
+		}
+		user.Identities = append(user.Identities, identity)
+		return user, http.StatusOK, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return user, http.StatusInternalServerError, errors.New("Failed to look up user")
+	}
+	firstName, lastName := claims.GivenName, claims.FamilyName
+	if firstName == "" {
+		firstName, lastName, _ = strings.Cut(claims.Name, " ")
+	}
+	if firstName == "" {
+		firstName, _, _ = strings.Cut(claims.Email, "@")
+	}
+	// no password: the account can sign in through the provider or set one
+	// with the password reset flow
+	user = models.User{
+		UserID:          bson.NewObjectID().Hex(),
+		FirstName:       firstName,
+		LastName:        lastName,
+		Email:           claims.Email,
+		EmailVerified:   true,
+		Roles:           []models.UserRole{models.USER},
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+		FavouriteGenres: []models.Genre{},
+		Identities:      []models.ExternalIdentity{identity},
+	}
+	if _, err := userCollection.InsertOne(mongoCtx, user); err != nil {
+		if utils.IsDuplicateKey(err) {
+			return user, http.StatusConflict, errors.New("An account with this email already exists")
+		}
+		return user, http.StatusInternalServerError, errors.New("Failed to create user")
+	}
+	err = utils.RecordAuditEvent(models.AuditEvent{
+		Type:     "user.create_external",
+		TargetID: user.UserID,
+		Details:  bson.M{"provider": provider},
+	})
+	if err != nil {
+		log.Println("Failed to record external sign-up:", err)
+	}
+	return user, http.StatusCreated, nil
+}
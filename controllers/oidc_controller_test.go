@@ -0,0 +1,272 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ardiannm/go/database"
+	"github.com/ardiannm/go/models"
+	"github.com/ardiannm/go/oidc"
+	"github.com/ardiannm/go/oidc/oidctest"
+	"github.com/ardiannm/go/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// startMockProvider registers the provider of cmd/mockoidc as "mock",
+// signing everyone in as email.
+func startMockProvider(t *testing.T, email string) *oidc.Provider {
+	t.Helper()
+	mock, err := oidctest.NewServer("", email, "Mock", "User")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(mock)
+	t.Cleanup(server.Close)
+	mock.Issuer = server.URL
+	provider := oidc.NewProvider(oidc.ProviderConfig{
+		Name:        "mock",
+		Issuer:      server.URL,
+		ClientID:    "gotrock",
+		RedirectURL: "http://localhost:8080/auth/oidc/mock/callback",
+		Scopes:      []string{"openid", "email", "profile"},
+	})
+	oidc.Providers["mock"] = provider
+	t.Cleanup(func() { delete(oidc.Providers, "mock") })
+	return provider
+}
+
+// the nonce and PKCE verifier of every test login
+const (
+	testNonce    = "test-nonce"
+	testVerifier = "test-code-verifier"
+)
+
+// authorize signs in at the provider and returns the callback it redirects
+// the browser to.
+func authorize(t *testing.T, provider *oidc.Provider, state string) string {
+	t.Helper()
+	authURL, err := provider.AuthCodeURL(context.Background(), state, testNonce, oidc.CodeChallenge(testVerifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || callback.Query().Get("code") == "" || callback.Query().Get("state") != state {
+		t.Fatalf("unexpected redirect %q", resp.Header.Get("Location"))
+	}
+	return callback.RequestURI()
+}
+
+// stateCookie is the cookie OIDCLogin sets for state.
+func stateCookie(state string) *http.Cookie {
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	utils.SetOIDCStateCookie(ctx, state, oidcStateLifetime)
+	return recorder.Result().Cookies()[0]
+}
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	provider := startMockProvider(t, "mock.user@example.com")
+	router := gin.New()
+	router.GET("/auth/oidc/:provider/callback", OIDCCallback())
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+	}{
+		{"no cookie", nil},
+		{"empty cookie", &http.Cookie{Name: utils.OIDCStateCookie, Value: ""}},
+		{"cookie of another login", stateCookie("state-of-another-login")},
+		{"state itself instead of its hash", &http.Cookie{Name: utils.OIDCStateCookie, Value: "forged-state"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, authorize(t, provider, "forged-state"), nil)
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			if recorder.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusBadRequest, recorder.Body)
+			}
+			// refused by the cookie check, before the pending login is looked up
+			var body struct{ Error string }
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil || !strings.Contains(body.Error, "not started from this browser") {
+				t.Fatalf("unexpected response %s", recorder.Body)
+			}
+			for _, cookie := range recorder.Result().Cookies() {
+				if cookie.Name == utils.OIDCStateCookie && cookie.MaxAge >= 0 {
+					t.Errorf("state cookie was not cleared: %v", cookie)
+				}
+			}
+		})
+	}
+}
+
+func TestOIDCStateCookieMatchesOnlyItsState(t *testing.T) {
+	cookie := stateCookie("state")
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.MaxAge <= 0 {
+		t.Fatalf("state cookie must be HttpOnly, SameSite=Lax and short-lived: %v", cookie)
+	}
+	for state, want := range map[string]bool{"state": true, "other": false} {
+		req := httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/callback", nil)
+		req.AddCookie(cookie)
+		recorder := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(recorder)
+		ctx.Request = req
+		if got := utils.ConsumeOIDCStateCookie(ctx, state); got != want {
+			t.Errorf("ConsumeOIDCStateCookie(%q) = %v, want %v", state, got, want)
+		}
+		cleared := recorder.Result().Cookies()
+		if len(cleared) != 1 || cleared[0].MaxAge >= 0 {
+			t.Errorf("state cookie was not cleared after checking %q", state)
+		}
+	}
+}
+
+// oidcLogin runs the callback for a login OIDCLogin would have started.
+func oidcLogin(t *testing.T, provider *oidc.Provider) *httptest.ResponseRecorder {
+	t.Helper()
+	state, err := oidc.RandomString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = utils.SaveOIDCState(models.OIDCState{
+		State:        state,
+		Provider:     provider.Name,
+		Nonce:        testNonce,
+		CodeVerifier: testVerifier,
+		ExpiresAt:    time.Now().Add(oidcStateLifetime),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.GET("/auth/oidc/:provider/callback", OIDCCallback())
+	req := httptest.NewRequest(http.MethodGet, authorize(t, provider, state), nil)
+	req.AddCookie(stateCookie(state))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// testEmail is an address no other test run uses; its account and sessions
+// are removed afterwards.
+func testEmail(t *testing.T) string {
+	t.Helper()
+	email := "oidc-" + bson.NewObjectID().Hex() + "@example.com"
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		var user models.User
+		if userCollection.FindOneAndDelete(ctx, bson.M{"email": email}).Decode(&user) == nil {
+			database.OpenCollection("sessions").DeleteMany(ctx, bson.M{"user_id": user.UserID})
+		}
+	})
+	return email
+}
+
+func insertTestUser(t *testing.T, email string, verified bool) models.User {
+	t.Helper()
+	user := models.User{
+		UserID:          bson.NewObjectID().Hex(),
+		FirstName:       "Existing",
+		LastName:        "User",
+		Email:           email,
+		EmailVerified:   verified,
+		Roles:           []models.UserRole{models.USER},
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+		FavouriteGenres: []models.Genre{},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := userCollection.InsertOne(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func storedUser(t *testing.T, email string) models.User {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"email": email}).Decode(&user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestOIDCCallbackCreatesUser(t *testing.T) {
+	requireDatabase(t)
+	email := testEmail(t)
+	recorder := oidcLogin(t, startMockProvider(t, email))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", recorder.Code, recorder.Body)
+	}
+	var response models.UserResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || response.Token == "" {
+		t.Fatalf("no tokens in %s", recorder.Body)
+	}
+	user := storedUser(t, email)
+	if response.UserID != user.UserID || !user.EmailVerified || user.Password != "" {
+		t.Fatalf("unexpected account %+v", user)
+	}
+	if len(user.Identities) != 1 || user.Identities[0].Provider != "mock" {
+		t.Fatalf("identities = %+v", user.Identities)
+	}
+	// signing in again finds the same account through the identity
+	recorder = oidcLogin(t, startMockProvider(t, email))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("second login: status = %d: %s", recorder.Code, recorder.Body)
+	}
+	if again := storedUser(t, email); again.UserID != user.UserID || len(again.Identities) != 1 {
+		t.Fatalf("second login changed the account: %+v", again)
+	}
+}
+
+func TestOIDCCallbackLinksVerifiedUser(t *testing.T) {
+	requireDatabase(t)
+	email := testEmail(t)
+	existing := insertTestUser(t, email, true)
+	recorder := oidcLogin(t, startMockProvider(t, email))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", recorder.Code, recorder.Body)
+	}
+	var response models.UserResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || response.UserID != existing.UserID {
+		t.Fatalf("signed in as someone else: %s", recorder.Body)
+	}
+	if user := storedUser(t, email); len(user.Identities) != 1 || user.Identities[0].Provider != "mock" {
+		t.Fatalf("identities = %+v", user.Identities)
+	}
+}
+
+func TestOIDCCallbackRefusesUnverifiedUser(t *testing.T) {
+	requireDatabase(t)
+	email := testEmail(t)
+	insertTestUser(t, email, false)
+	recorder := oidcLogin(t, startMockProvider(t, email))
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusConflict, recorder.Body)
+	}
+	if user := storedUser(t, email); len(user.Identities) != 0 || user.EmailVerified {
+		t.Fatalf("unverified account was linked: %+v", user)
+	}
+}
@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ardiannm/go/config"
+	"github.com/ardiannm/go/mailer"
+	"github.com/ardiannm/go/models"
+	"github.com/ardiannm/go/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// passwordAcceptable checks password against the password policy for user
+// and answers with every violation when it fails.
+func passwordAcceptable(ctx *gin.Context, password string, user models.User) bool {
+	violations, err := utils.PasswordPolicyViolations(password, user)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check password", "reasons": err.Error()})
+		return false
+	}
+	if len(violations) > 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Password does not meet the password policy", "reasons": violations})
+		return false
+	}
+	return true
+}
+
+func ForgotPassword() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req models.ForgotPasswordRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "reasons": err.Error()})
+			return
+		}
+		// the response never reveals whether the email is registered
+		accepted := gin.H{"message": "If the email is registered, a reset link has been sent"}
+		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		var foundUser models.User
+		err := userCollection.FindOne(mongoCtx, bson.M{"email": req.Email}).Decode(&foundUser)
+		if err == mongo.ErrNoDocuments {
+			ctx.JSON(http.StatusAccepted, accepted)
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up user"})
+			return
+		}
+		token, tokenHash, err := utils.GenerateSecureToken()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate reset token"})
+			return
+		}
+		update := bson.M{
+			"$set": bson.M{
+				"password_reset": models.SecretToken{
+					TokenHash: tokenHash,
+					CreatedAt: time.Now(),
+					ExpiresAt: time.Now().Add(time.Duration(config.Env.PASSWORD_RESET_TTL_MINUTES) * time.Minute),
+				},
+				"updated_at": time.Now(),
+			},
+		}
+		if _, err := userCollection.UpdateOne(mongoCtx, bson.M{"user_id": foundUser.UserID}, update); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store reset token"})
+			return
+		}
+		link := config.Env.APP_BASE_URL + "/reset-password?token=" + url.QueryEscape(token)
+		err = mailer.Send(mailer.Message{
+			To:      foundUser.Email,
+			Subject: "Reset your Gotrock password",
+			Body: "Hi " + foundUser.FirstName + ",\n\n" +
+				"Use the link below to choose a new password. It expires in " +
+				strconv.FormatInt(config.Env.PASSWORD_RESET_TTL_MINUTES, 10) + " minutes.\n\n" +
+				link + "\n\n" +
+				"If you did not ask for a reset you can ignore this email.\n",
+		})
+		if err != nil {
+			log.Println("Failed to send password reset email:", err)
+		}
+		ctx.JSON(http.StatusAccepted, accepted)
+	}
+}
+
+func ResetPassword() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req models.ResetPasswordRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "reasons": err.Error()})
+			return
+		}
+		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		filter := bson.M{
+			"password_reset.token_hash": utils.HashSecureToken(req.Token),
+			"password_reset.expires_at": bson.M{"$gt": time.Now()},
+		}
+		var tokenOwner models.User
+		err := userCollection.FindOne(mongoCtx, filter).Decode(&tokenOwner)
+		if err == mongo.ErrNoDocuments {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Reset token is invalid or has expired"})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+			return
+		}
+		if !passwordAcceptable(ctx, req.Password, tokenOwner) {
+			return
+		}
+		hashed, err := utils.HashPassword(req.Password)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to hash password"})
+			return
+		}
+		// matching and clearing the token in one update keeps it single-use
+		update := bson.M{
+			"$set":   bson.M{"password": hashed, "updated_at": time.Now()},
+			"$unset": bson.M{"password_reset": ""},
+		}
+		var foundUser models.User
+		err = userCollection.FindOneAndUpdate(mongoCtx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&foundUser)
+		if err == mongo.ErrNoDocuments {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Reset token is invalid or has expired"})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+			return
+		}
+		if err := utils.RevokeAllUserTokens(foundUser.UserID); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens", "reasons": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+	}
+}
@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ardiannm/go/config"
+	"github.com/ardiannm/go/mailer"
+	"github.com/ardiannm/go/models"
+	"github.com/ardiannm/go/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// currentUser loads the account of the authenticated caller, writing an error
+// response when it cannot.
+func currentUser(ctx *gin.Context) (models.User, bool) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "User Id not found in context"})
+		return models.User{}, false
+	}
+	user, err := findUserByID(userID)
+	if err == mongo.ErrNoDocuments {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return user, false
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user", "reasons": err.Error()})
+		return user, false
+	}
+	return user, true
+}
+
+func GetProfile() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, ok := currentUser(ctx)
+		if !ok {
+			return
+		}
+		ctx.JSON(http.StatusOK, user.Profile())
+	}
+}
+
+func UpdateProfile() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !forbidImpersonation(ctx) {
+			return
+		}
+		userID, err := utils.GetUserIDFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "User Id not found in context"})
+			return
+		}
+		var req models.UpdateProfileRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "reasons": err.Error()})
+			return
+		}
+		set := bson.M{"updated_at": time.Now()}
+		if req.FirstName != nil {
+			set["first_name"] = *req.FirstName
+		}
+		if req.LastName != nil {
+			set["last_name"] = *req.LastName
+		}
+		if req.FavouriteGenres != nil {
+			set["favourite_genres"] = *req.FavouriteGenres
+		}
+		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		var user models.User
+		err = userCollection.FindOneAndUpdate(mongoCtx, bson.M{"user_id": userID}, bson.M{"$set": set},
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&user)
+		if err == mongo.ErrNoDocuments {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile", "reasons": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, user.Profile())
+	}
+}
+
+func ChangePassword() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !requireSession(ctx) {
+			return
+		}
+		var req models.ChangePasswordRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "reasons": err.Error()})
+			return
+		}
+		user, ok := currentUser(ctx)
+		if !ok {
+			return
+		}
+		if user.Password == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Account has no password, use the password reset flow to set one"})
+			return
+		}
+		// a stolen session must not become a way around the login throttle
+		if loginLockedOut(ctx, user.Email) {
+			return
+		}
+		if ok, _, _ := utils.VerifyPassword(user.Password, req.CurrentPassword); !ok {
+			recordFailedLogin(ctx, user.Email, user.UserID, "Current password is incorrect")
+			return
+		}
+		if err := utils.ClearLoginFailures(utils.AccountThrottleKey(user.Email)); err != nil {
+			log.Println("Failed to clear login failures:", err)
+		}
+		if !passwordAcceptable(ctx, req.NewPassword, user) {
+			return
+		}
+		hashed, err := utils.HashPassword(req.NewPassword)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to hash password"})
+			return
+		}
+		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		// matching on the old hash keeps a concurrent change from being lost
+		filter := bson.M{"user_id": user.UserID, "password": user.Password}
+		update := bson.M{
+			"$set":   bson.M{"password": hashed, "updated_at": time.Now()},
+			"$unset": bson.M{"password_reset": ""},
+		}
+		result, err := userCollection.UpdateOne(mongoCtx, filter, update)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Password changed concurrently, please retry"})
+			return
+		}
+		signedOut, err := utils.DeleteOtherSessions(user.UserID, ctx.GetString("sessionId"))
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke other sessions", "reasons": err.Error()})
+			return
+		}
+		err = utils.RecordAuditEvent(models.AuditEvent{
+			Type:     "password.change",
+			ActorID:  user.UserID,
+			TargetID: user.UserID,
+			IP:       ctx.ClientIP(),
+			Details:  bson.M{"revoked_sessions": signedOut},
+		})
+		if err != nil {
+			log.Println("Failed to record password change:", err)
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Password changed", "revoked_sessions": signedOut})
+	}
+}
+
+// DeleteAccount schedules the caller's account for deletion. Nothing is
+// removed until the grace period ends; signing in again before then cancels
+// it (see completeLogin).
+func DeleteAccount() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !requireSession(ctx) {
+			return
+		}
+		var req models.DeleteAccountRequest
+		if ctx.Request.ContentLength != 0 {
+			if err := ctx.ShouldBindJSON(&req); err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+				return
+			}
+		}
+		user, ok := currentUser(ctx)
+		if !ok {
+			return
+		}
+		if user.Password != "" {
+			if ok, _, _ := utils.VerifyPassword(user.Password, req.Password); !ok {
+				ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+				return
+			}
+		}
+		deleteAt := time.Now().Add(time.Duration(config.Env.ACCOUNT_DELETION_GRACE_DAYS) * 24 * time.Hour)
+		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		update := bson.M{"$set": bson.M{"deletion_scheduled_at": deleteAt, "updated_at": time.Now()}}
+		if _, err := userCollection.UpdateOne(mongoCtx, bson.M{"user_id": user.UserID}, update); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule deletion"})
+			return
+		}
+		if err := utils.RevokeAllUserTokens(user.UserID); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens", "reasons": err.Error()})
+			return
+		}
+		err := utils.RecordAuditEvent(models.AuditEvent{
+			Type:     "account.delete_scheduled",
+			ActorID:  user.UserID,
+			TargetID: user.UserID,
+			IP:       ctx.ClientIP(),
+			Details:  bson.M{"delete_at": deleteAt},
+		})
+		if err != nil {
+			log.Println("Failed to record account deletion:", err)
+		}
+		err = mailer.Send(mailer.Message{
+			To:      user.Email,
+			Subject: "Your Gotrock account will be deleted",
+			Body: "Hi " + user.FirstName + ",\n\n" +
+				"Your account is scheduled for deletion on " + deleteAt.Format("2 January 2006") + ".\n" +
+				"Sign in before then if you want to keep it.\n",
+		})
+		if err != nil {
+			log.Println("Failed to send account deletion email:", err)
+		}
+		if config.Env.AUTH_COOKIES_ENABLED {
+			utils.ClearAuthCookies(ctx)
+		}
+		ctx.JSON(http.StatusAccepted, gin.H{"message": "Account scheduled for deletion", "deletion_scheduled_at": deleteAt})
+	}
+}
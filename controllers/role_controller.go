@@ -0,0 +1,314 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/ardiannm/go/database"
+	"github.com/ardiannm/go/models"
+	"github.com/ardiannm/go/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var roleCollection *mongo.Collection = database.OpenCollection("roles")
+
+func findRole(name models.UserRole) (models.Role, error) {
+	mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var role models.Role
+	err := roleCollection.FindOne(mongoCtx, bson.M{"name": name}).Decode(&role)
+	return role, err
+}
+
+// rolePermissions is what holding the role allows; ADMIN allows everything.
+func rolePermissions(role models.Role) []models.Permission {
+	if role.Name == models.ADMIN {
+		return models.AllPermissions
+	}
+	return role.Permissions
+}
+
+// canHandOut answers 403 unless the caller holds every one of permissions,
+// so a delegated roles:manage cannot raise anyone, itself included, above
+// its own rights, least of all to ADMIN.
+func canHandOut(ctx *gin.Context, permissions []models.Permission) bool {
+	held, _ := utils.GetPermissionsFromContext(ctx)
+	for _, permission := range permissions {
+		if !slices.Contains(held, permission) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "You cannot hand out a permission you do not hold", "permission": permission})
+			return false
+		}
+	}
+	return true
+}
+
+// setUserRoles replaces the user's roles, refusing if they changed in the
+// meantime, revokes outstanding tokens and writes an audit entry.
+func setUserRoles(ctx *gin.Context, eventType string, user models.User, roles []models.UserRole) bool {
+	adminID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "User Id not found in context"})
+		return false
+	}
+	if adminID == user.UserID {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Admins cannot change their own roles"})
+		return false
+	}
+	mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	filter := bson.M{"user_id": user.UserID, "updated_at": user.UpdatedAt}
+	update := bson.M{
+		"$set":   bson.M{"roles": roles, "updated_at": time.Now()},
+		"$unset": bson.M{"role": ""},
+	}
+	result, err := userCollection.UpdateOne(mongoCtx, filter, update)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update roles", "reasons": err.Error()})
+		return false
+	}
+	if result.MatchedCount == 0 {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "User changed concurrently, please retry"})
+		return false
+	}
+	// tokens carry roles and permissions, so outstanding ones must not
+	// outlive the change
+	if err := utils.RevokeAllUserTokens(user.UserID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens", "reasons": err.Error()})
+		return false
+	}
+	err = utils.RecordAuditEvent(models.AuditEvent{
+		Type:     eventType,
+		ActorID:  adminID,
+		TargetID: user.UserID,
+		IP:       ctx.ClientIP(),
+		Details:  bson.M{"previous_roles": user.RoleNames(), "roles": roles},
+	})
+	if err != nil {
+		log.Println("Failed to record role change:", err)
+	}
+	return true
+}
+
+func GrantUserRole() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		role, err := findRole(models.UserRole(ctx.Param("role")))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+			return
+		}
+		if !canHandOut(ctx, rolePermissions(role)) {
+			return
+		}
+		user, err := findUserByID(ctx.Param("user_id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if user.HasRole(role.Name) {
+			ctx.JSON(http.StatusOK, gin.H{"user_id": user.UserID, "roles": user.RoleNames()})
+			return
+		}
+		roles := append(slices.Clone(user.RoleNames()), role.Name)
+		if !setUserRoles(ctx, "role.grant", user, roles) {
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"user_id": user.UserID, "roles": roles})
+	}
+}
+
+func RevokeUserRole() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		role := models.UserRole(ctx.Param("role"))
+		if role == models.USER {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "The USER role cannot be revoked"})
+			return
+		}
+		// taking a role away is as privileged as handing it out
+		if found, err := findRole(role); err == nil && !canHandOut(ctx, rolePermissions(found)) {
+			return
+		}
+		user, err := findUserByID(ctx.Param("user_id"))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if !user.HasRole(role) {
+			ctx.JSON(http.StatusOK, gin.H{"user_id": user.UserID, "roles": user.RoleNames()})
+			return
+		}
+		roles := slices.DeleteFunc(slices.Clone(user.RoleNames()), func(r models.UserRole) bool { return r == role })
+		if !slices.Contains(roles, models.USER) {
+			roles = append(roles, models.USER)
+		}
+		if !setUserRoles(ctx, "role.revoke", user, roles) {
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"user_id": user.UserID, "roles": roles})
+	}
+}
+
+func GetRoles() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		cursor, err := roleCollection.Find(mongoCtx, bson.M{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+			return
+		}
+		defer cursor.Close(mongoCtx)
+		roles := []models.Role{}
+		if err := cursor.All(mongoCtx, &roles); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode roles", "reasons": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"roles": roles, "permissions": models.AllPermissions})
+	}
+}
+
+// PutRole creates or replaces a role definition. ADMIN always holds every
+// permission and cannot be redefined. Holders of the role are signed out,
+// as their tokens carry the permissions it had.
+func PutRole() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		adminID, err := utils.GetUserIDFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "User Id not found in context"})
+			return
+		}
+		name := models.UserRole(ctx.Param("name"))
+		if name == models.ADMIN {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "The ADMIN role cannot be redefined"})
+			return
+		}
+		var definition models.RoleDefinition
+		if err := ctx.ShouldBindJSON(&definition); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+			return
+		}
+		if err := validate.Struct(definition); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "reasons": err.Error()})
+			return
+		}
+		for _, permission := range definition.Permissions {
+			if !permission.IsValid() {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission", "permission": permission})
+				return
+			}
+		}
+		if !canHandOut(ctx, definition.Permissions) {
+			return
+		}
+		now := time.Now()
+		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		update := bson.M{
+			"$set": bson.M{
+				"description": definition.Description,
+				"permissions": definition.Permissions,
+				"updated_at":  now,
+			},
+			"$setOnInsert": bson.M{"built_in": false, "created_at": now},
+		}
+		updateOptions := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+		var role models.Role
+		err = roleCollection.FindOneAndUpdate(mongoCtx, bson.M{"name": name}, update, updateOptions).Decode(&role)
+		if utils.IsDuplicateKey(err) {
+			// two concurrent upserts of a new role can both try to insert it
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Role was created concurrently, please retry"})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save role", "reasons": err.Error()})
+			return
+		}
+		// holders' tokens carry the old permissions
+		holders, err := revokeRoleHolderTokens(name)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens", "reasons": err.Error()})
+			return
+		}
+		err = utils.RecordAuditEvent(models.AuditEvent{
+			Type:    "role.define",
+			ActorID: adminID,
+			IP:      ctx.ClientIP(),
+			Details: bson.M{"role": name, "permissions": definition.Permissions, "holders_signed_out": holders},
+		})
+		if err != nil {
+			log.Println("Failed to record role definition:", err)
+		}
+		ctx.JSON(http.StatusOK, role)
+	}
+}
+
+// roleHolderFilter matches the users holding the role, including accounts
+// still carrying it in the single role field they had before roles.
+func roleHolderFilter(name models.UserRole) bson.M {
+	return bson.M{"$or": bson.A{bson.M{"roles": name}, bson.M{"role": name}}}
+}
+
+// revokeRoleHolderTokens signs out every user holding the role and returns
+// how many there were.
+func revokeRoleHolderTokens(name models.UserRole) (int, error) {
+	mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var holders []string
+	err := userCollection.Distinct(mongoCtx, "user_id", roleHolderFilter(name)).Decode(&holders)
+	if err != nil {
+		return 0, err
+	}
+	if err := utils.RevokeUsersTokens(holders); err != nil {
+		return 0, err
+	}
+	return len(holders), nil
+}
+
+func DeleteRole() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		adminID, err := utils.GetUserIDFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "User Id not found in context"})
+			return
+		}
+		role, err := findRole(models.UserRole(ctx.Param("name")))
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+			return
+		}
+		if role.BuiltIn {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Built-in roles cannot be deleted"})
+			return
+		}
+		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		holders, err := userCollection.CountDocuments(mongoCtx, roleHolderFilter(role.Name))
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check role holders"})
+			return
+		}
+		if holders > 0 {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Role is still assigned to users", "holders": holders})
+			return
+		}
+		if _, err := roleCollection.DeleteOne(mongoCtx, bson.M{"name": role.Name}); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+			return
+		}
+		err = utils.RecordAuditEvent(models.AuditEvent{
+			Type:    "role.delete",
+			ActorID: adminID,
+			IP:      ctx.ClientIP(),
+			Details: bson.M{"role": role.Name},
+		})
+		if err != nil {
+			log.Println("Failed to record role deletion:", err)
+		}
+		ctx.JSON(http.StatusOK, gin.H{"deleted": true, "role": role.Name})
+	}
+}
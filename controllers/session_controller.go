@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/ardiannm/go/config"
+	"github.com/ardiannm/go/models"
+	"github.com/ardiannm/go/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func GetSessions() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !requireSession(ctx) {
+			return
+		}
+		userID, err := utils.GetUserIDFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "User Id not found in context"})
+			return
+		}
+		sessions, err := utils.GetUserSessions(userID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions", "reasons": err.Error()})
+			return
+		}
+		current := ctx.GetString("sessionId")
+		for i := range sessions {
+			sessions[i].Current = sessions[i].SessionID == current
+		}
+		ctx.JSON(http.StatusOK, sessions)
+	}
+}
+
+func RevokeSession() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !requireSession(ctx) {
+			return
+		}
+		userID, err := utils.GetUserIDFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "User Id not found in context"})
+			return
+		}
+		sessionID := ctx.Param("session_id")
+		deleted, err := utils.DeleteSession(userID, sessionID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session", "reasons": err.Error()})
+			return
+		}
+		if !deleted {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		err = utils.RecordAuditEvent(models.AuditEvent{
+			Type:     "session.revoke",
+			ActorID:  userID,
+			TargetID: sessionID,
+			IP:       ctx.ClientIP(),
+			Details:  bson.M{"from_session": ctx.GetString("sessionId")},
+		})
+		if err != nil {
+			log.Println("Failed to record session revocation:", err)
+		}
+		if sessionID == ctx.GetString("sessionId") && config.Env.AUTH_COOKIES_ENABLED {
+			utils.ClearAuthCookies(ctx)
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+	}
+}
@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/ardiannm/go/models"
+	"github.com/ardiannm/go/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const recoveryCodeCount = 10
+
+func findUserByID(userID string) (models.User, error) {
+	mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var user models.User
+	err := userCollection.FindOne(mongoCtx, bson.M{"user_id": userID}).Decode(&user)
+	return user, err
+}
+
+// verifySecondFactor accepts either a TOTP code or a recovery code and
+// consumes it, so the same code cannot be used twice.
+func verifySecondFactor(user models.User, code, recoveryCode string) (bool, error) {
+	if !user.TwoFactorEnabled() {
+		return false, nil
+	}
+	mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if code != "" {
+		step, ok := utils.ValidateTOTP(user.TwoFactor.Secret, code, user.TwoFactor.LastUsedStep, time.Now())
+		if !ok {
+			return false, nil
+		}
+		// repeated here for two logins racing with the same code
+		filter := bson.M{"user_id": user.UserID, "two_factor.last_used_step": bson.M{"$lt": step}}
+		result, err := userCollection.UpdateOne(mongoCtx, filter, bson.M{"$set": bson.M{"two_factor.last_used_step": step}})
+		if err != nil {
+			return false, err
+		}
+		return result.MatchedCount == 1, nil
+	}
+	if recoveryCode == "" {
+		return false, nil
+	}
+	hash := utils.HashRecoveryCode(recoveryCode)
+	filter := bson.M{"user_id": user.UserID, "two_factor.recovery_codes": hash}
+	result, err := userCollection.UpdateOne(mongoCtx, filter, bson.M{"$pull": bson.M{"two_factor.recovery_codes": hash}})
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+func SetupTwoFactor() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !requireSession(ctx) {
+			return
+		}
+		userID, err := utils.GetUserIDFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "User Id not found in context"})
+			return
+		}
+		user, err := findUserByID(userID)
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if user.TwoFactorEnabled() {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+			return
+		}
+		secret, err := utils.GenerateTOTPSecret()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+			return
+		}
+		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		update := bson.M{"$set": bson.M{"two_factor": models.TwoFactor{PendingSecret: secret}, "updated_at": time.Now()}}
+		if _, err := userCollection.UpdateOne(mongoCtx, bson.M{"user_id": userID}, update); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store secret"})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"secret":      secret,
+			"otpauth_uri": utils.TOTPProvisioningURI("Gotrock", user.Email, secret),
+		})
+	}
+}
+
+func ConfirmTwoFactor() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !requireSession(ctx) {
+			return
+		}
+		userID, err := utils.GetUserIDFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "User Id not found in context"})
+			return
+		}
+		var req models.TwoFactorCodeRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil || req.Code == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "A code from the authenticator app is required"})
+			return
+		}
+		user, err := findUserByID(userID)
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if user.TwoFactor == nil || user.TwoFactor.PendingSecret == "" {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Two-factor setup has not been started"})
+			return
+		}
+		step, ok := utils.ValidateTOTP(user.TwoFactor.PendingSecret, req.Code, 0, time.Now())
+		if !ok {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+			return
+		}
+		codes, hashes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+			return
+		}
+		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		filter := bson.M{"user_id": userID, "two_factor.pending_secret": user.TwoFactor.PendingSecret}
+		update := bson.M{"$set": bson.M{
+			"two_factor": models.TwoFactor{
+				Enabled:       true,
+				Secret:        user.TwoFactor.PendingSecret,
+				LastUsedStep:  step,
+				RecoveryCodes: hashes,
+				EnabledAt:     time.Now(),
+			},
+			"updated_at": time.Now(),
+		}}
+		result, err := userCollection.UpdateOne(mongoCtx, filter, update)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Two-factor setup has changed, please start again"})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"message":        "Two-factor authentication enabled. Log in again to refresh your permissions.",
+			"recovery_codes": codes,
+		})
+	}
+}
+
+func DisableTwoFactor() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !requireSession(ctx) {
+			return
+		}
+		userID, err := utils.GetUserIDFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "User Id not found in context"})
+			return
+		}
+		var req models.TwoFactorCodeRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+			return
+		}
+		user, err := findUserByID(userID)
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if !user.TwoFactorEnabled() {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is not enabled"})
+			return
+		}
+		ok, err := verifySecondFactor(user, req.Code, req.RecoveryCode)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+			return
+		}
+		if !ok {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+			return
+		}
+		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		update := bson.M{"$unset": bson.M{"two_factor": ""}, "$set": bson.M{"updated_at": time.Now()}}
+		if _, err := userCollection.UpdateOne(mongoCtx, bson.M{"user_id": userID}, update); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+			return
+		}
+		// admin tokens were only granted because 2FA was on
+		if user.HasRole(models.ADMIN) {
+			if err := utils.RevokeAllUserTokens(userID); err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens", "reasons": err.Error()})
+				return
+			}
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+	}
+}
+
+func LoginTwoFactor() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req models.TwoFactorLoginRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "reasons": err.Error()})
+			return
+		}
+		claims, err := utils.ValidateChallengeToken(req.ChallengeToken)
+		if err != nil {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge token"})
+			return
+		}
+		user, err := findUserByID(claims.UserID)
+		if err != nil {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge token"})
+			return
+		}
+		if loginLockedOut(ctx, user.Email) {
+			return
+		}
+		ok, err := verifySecondFactor(user, req.Code, req.RecoveryCode)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+			return
+		}
+		if !ok {
+			recordFailedLogin(ctx, user.Email, user.UserID, "Invalid code")
+			return
+		}
+		completeLogin(ctx, user)
+	}
+}
@@ -2,9 +2,13 @@ package controllers
 
 import (
 	"context"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/ardiannm/go/config"
 	"github.com/ardiannm/go/database"
 	"github.com/ardiannm/go/models"
 	"github.com/ardiannm/go/utils"
@@ -12,43 +16,52 @@ import (
 	"github.com/go-playground/validator/v10"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
-	"golang.org/x/crypto/bcrypt"
 )
 
 var userCollection *mongo.Collection = database.OpenCollection("users")
 
-func HashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	return string(hash), nil
-}
-
 func RegisterUser() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		var user models.User
-		if err := ctx.ShouldBindJSON(&user); err != nil {
+		var registration models.UserRegistration
+		if err := ctx.ShouldBindJSON(&registration); err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
 			return
 		}
 		validate := validator.New()
-		if err := validate.Struct(user); err != nil {
+		if err := validate.Struct(registration); err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "reasons": err.Error()})
 			return
 		}
+		// self-registration creates USER accounts; only an invitation can add
+		// a role on top, see GrantUserRole for everything else
+		user := models.User{
+			FirstName:       registration.FirstName,
+			LastName:        registration.LastName,
+			Email:           registration.Email,
+			Password:        registration.Password,
+			Roles:           []models.UserRole{models.USER},
+			FavouriteGenres: registration.FavouriteGenres,
+		}
+		if !passwordAcceptable(ctx, user.Password, user) {
+			return
+		}
+		if config.Env.REQUIRE_INVITATION && registration.InvitationCode == "" {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Registration requires an invitation code"})
+			return
+		}
 		var mongoCtx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 		count, err := userCollection.CountDocuments(mongoCtx, bson.M{"email": user.Email})
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check existing user"})
+			return
 		}
 		if count > 0 {
 			ctx.JSON(http.StatusConflict, gin.H{"error": "User already exists"})
 			return
 		}
 		user.UserID = bson.NewObjectID().Hex()
-		hashed, err := HashPassword(user.Password)
+		hashed, err := utils.HashPassword(user.Password)
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to hash password"})
 			return
@@ -56,73 +69,434 @@ func RegisterUser() gin.HandlerFunc {
 		user.Password = hashed
 		user.CreatedAt = time.Now()
 		user.UpdatedAt = time.Now()
+		var invitation models.Invitation
+		if registration.InvitationCode != "" {
+			invitation, err = utils.RedeemInvitation(registration.InvitationCode, models.InvitationRedemption{
+				UserID:     user.UserID,
+				Email:      user.Email,
+				IP:         ctx.ClientIP(),
+				RedeemedAt: time.Now(),
+			})
+			if err == utils.ErrInvitationInvalid {
+				ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeem invitation"})
+				return
+			}
+			if invitation.Role != "" && invitation.Role != models.USER {
+				user.Roles = append(user.Roles, invitation.Role)
+			}
+		}
 		result, err := userCollection.InsertOne(mongoCtx, user)
 		if err != nil {
+			if invitation.InvitationID != "" {
+				if err := utils.ReleaseInvitation(invitation.InvitationID, user.UserID); err != nil {
+					log.Println("Failed to release invitation:", err)
+				}
+			}
+			// the unique email index catches registrations racing past the
+			// check above
+			if utils.IsDuplicateKey(err) {
+				ctx.JSON(http.StatusConflict, gin.H{"error": "User already exists"})
+				return
+			}
 			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create user"})
 			return
 		}
+		if invitation.InvitationID != "" {
+			err = utils.RecordAuditEvent(models.AuditEvent{
+				Type:     "invitation.redeem",
+				ActorID:  user.UserID,
+				TargetID: invitation.InvitationID,
+				IP:       ctx.ClientIP(),
+				Details:  bson.M{"roles": user.Roles},
+			})
+			if err != nil {
+				log.Println("Failed to record invitation redemption:", err)
+			}
+		}
+		if err := sendVerificationEmail(user); err != nil {
+			log.Println("Failed to send verification email:", err)
+		}
 		ctx.JSON(http.StatusCreated, result)
 	}
 }
 
-func GetUsers() gin.HandlerFunc {
+func LoginUser() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
+		var userLogin models.UserLogin
+		if err := ctx.ShouldBindJSON(&userLogin); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+			return
+		}
+		if loginLockedOut(ctx, userLogin.Email) {
+			return
+		}
 		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
-		var users []models.User
-		cursor, err := userCollection.Find(mongoCtx, bson.M{})
+		var foundUser models.User
+		err := userCollection.FindOne(mongoCtx, bson.M{"email": userLogin.Email}).Decode(&foundUser)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+			recordFailedLogin(ctx, userLogin.Email, "", "Invalid email or password")
 			return
 		}
-		defer cursor.Close(mongoCtx)
-		if err = cursor.All(mongoCtx, &users); err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode users", "reasons": err.Error()})
+		ok, needsRehash, err := utils.VerifyPassword(foundUser.Password, userLogin.Password)
+		if err != nil {
+			log.Println("Failed to verify password:", err)
+		}
+		if !ok {
+			recordFailedLogin(ctx, foundUser.Email, foundUser.UserID, "Invalid email or password")
 			return
 		}
-		ctx.JSON(http.StatusOK, users)
+		if needsRehash {
+			rehashPassword(foundUser, userLogin.Password)
+		}
+		finishPrimaryLogin(ctx, foundUser)
 	}
 }
 
-func LoginUser() gin.HandlerFunc {
+// rehashPassword replaces a stored hash that uses an outdated algorithm or
+// cost. Login goes ahead even when this fails; it is retried next time.
+func rehashPassword(user models.User, password string) {
+	hashed, err := utils.HashPassword(password)
+	if err != nil {
+		log.Println("Failed to rehash password:", err)
+		return
+	}
+	mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// matching the old hash keeps a concurrent password change intact
+	filter := bson.M{"user_id": user.UserID, "password": user.Password}
+	if _, err := userCollection.UpdateOne(mongoCtx, filter, bson.M{"$set": bson.M{"password": hashed}}); err != nil {
+		log.Println("Failed to store rehashed password:", err)
+	}
+}
+
+// finishPrimaryLogin runs the checks shared by every first-factor login
+// (password or external provider) and then either asks for the second
+// factor or issues tokens.
+func finishPrimaryLogin(ctx *gin.Context, user models.User) {
+	if config.Env.REQUIRE_EMAIL_VERIFICATION && !user.EmailVerified {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Email address has not been verified"})
+		return
+	}
+	if user.TwoFactorEnabled() {
+		challengeToken, err := utils.GenerateChallengeToken(user.UserID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate challenge token", "reasons": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"two_factor_required": true, "challenge_token": challengeToken})
+		return
+	}
+	completeLogin(ctx, user)
+}
+
+// loginLockedOut answers with 429 and Retry-After when either the account
+// or the client address is currently locked out.
+func loginLockedOut(ctx *gin.Context, email string) bool {
+	retryAfter, err := utils.LoginRetryAfter(utils.AccountThrottleKey(email), utils.IPThrottleKey(ctx.ClientIP()))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check login attempts"})
+		return true
+	}
+	if retryAfter <= 0 {
+		return false
+	}
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	ctx.Header("Retry-After", strconv.Itoa(seconds))
+	ctx.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, try again later", "retry_after": seconds})
+	return true
+}
+
+// recordFailedLogin counts the failure against the account and the client
+// address, records any lockout it triggers and writes the response.
+func recordFailedLogin(ctx *gin.Context, email, userID, message string) {
+	limits := []struct {
+		key       string
+		threshold int64
+	}{
+		{utils.AccountThrottleKey(email), config.Env.LOGIN_MAX_FAILURES_PER_ACCOUNT},
+		{utils.IPThrottleKey(ctx.ClientIP()), config.Env.LOGIN_MAX_FAILURES_PER_IP},
+	}
+	var lockout time.Duration
+	for _, limit := range limits {
+		locked, attempt, err := utils.RecordLoginFailure(limit.key, limit.threshold)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record login attempt"})
+			return
+		}
+		if locked <= 0 {
+			continue
+		}
+		lockout = max(lockout, locked)
+		err = utils.RecordAuditEvent(models.AuditEvent{
+			Type:     "login.lockout",
+			TargetID: userID,
+			IP:       ctx.ClientIP(),
+			Details: bson.M{
+				"key":          limit.key,
+				"failures":     attempt.Failures,
+				"locked_until": attempt.LockedUntil,
+			},
+		})
+		if err != nil {
+			log.Println("Failed to record lockout event:", err)
+		}
+	}
+	if lockout > 0 {
+		seconds := int(math.Ceil(lockout.Seconds()))
+		ctx.Header("Retry-After", strconv.Itoa(seconds))
+		ctx.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, try again later", "retry_after": seconds})
+		return
+	}
+	ctx.JSON(http.StatusUnauthorized, gin.H{"error": message})
+}
+
+// generateUserTokens mints a token pair for the given session with the
+// permissions the user's roles currently grant.
+func generateUserTokens(user models.User, sessionID string) (models.UserResponse, error) {
+	roles := utils.EffectiveRoles(user)
+	permissions, err := utils.ResolvePermissions(roles)
+	if err != nil {
+		return models.UserResponse{}, err
+	}
+	token, refreshToken, err := utils.GenerateAllTokens(user.Email, user.FirstName, user.LastName, user.UserID, roles, permissions, sessionID)
+	if err != nil {
+		return models.UserResponse{}, err
+	}
+	return models.UserResponse{
+		UserID:                      user.UserID,
+		FirstName:                   user.FirstName,
+		LastName:                    user.LastName,
+		Email:                       user.Email,
+		EmailVerified:               user.EmailVerified,
+		Role:                        utils.PrimaryRole(roles),
+		Roles:                       roles,
+		Permissions:                 permissions,
+		Token:                       token,
+		RefreshToken:                refreshToken,
+		FavouriteGenres:             user.FavouriteGenres,
+		TwoFactorEnrollmentRequired: len(roles) != len(user.RoleNames()),
+	}, nil
+}
+
+// completeLogin starts a new session for an authenticated user and writes
+// the token pair to the response.
+func completeLogin(ctx *gin.Context, user models.User) {
+	if user.DisabledAt != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return
+	}
+	if err := utils.ClearLoginFailures(utils.AccountThrottleKey(user.Email)); err != nil {
+		log.Println("Failed to clear login failures:", err)
+	}
+	if user.DeletionScheduledAt != nil {
+		restoreAccount(ctx, user)
+	}
+	sessionID := utils.NewSessionID()
+	response, err := generateUserTokens(user, sessionID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens", "reasons": err.Error()})
+		return
+	}
+	if err := utils.CreateSession(ctx, user.UserID, sessionID, response.RefreshToken); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session", "reasons": err.Error()})
+		return
+	}
+	writeTokenResponse(ctx, response)
+}
+
+// restoreAccount cancels a pending deletion when its owner signs in again.
+func restoreAccount(ctx *gin.Context, user models.User) {
+	mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	update := bson.M{"$unset": bson.M{"deletion_scheduled_at": ""}, "$set": bson.M{"updated_at": time.Now()}}
+	if _, err := userCollection.UpdateOne(mongoCtx, bson.M{"user_id": user.UserID}, update); err != nil {
+		log.Println("Failed to cancel account deletion:", err)
+		return
+	}
+	err := utils.RecordAuditEvent(models.AuditEvent{
+		Type:     "account.restore",
+		ActorID:  user.UserID,
+		TargetID: user.UserID,
+		IP:       ctx.ClientIP(),
+		Details:  bson.M{"scheduled_for": user.DeletionScheduledAt},
+	})
+	if err != nil {
+		log.Println("Failed to record account restore:", err)
+	}
+}
+
+// writeTokenResponse returns the tokens in the body, or in cookie mode moves
+// them into HttpOnly cookies and returns only the CSRF token.
+func writeTokenResponse(ctx *gin.Context, response models.UserResponse) {
+	if config.Env.AUTH_COOKIES_ENABLED {
+		csrfToken, err := utils.SetAuthCookies(ctx, response.Token, response.RefreshToken)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set cookies", "reasons": err.Error()})
+			return
+		}
+		response.Token = ""
+		response.RefreshToken = ""
+		response.CSRFToken = csrfToken
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+func RefreshToken() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		var userLogin models.UserLogin
-		if err := ctx.ShouldBindJSON(&userLogin); err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+		var req models.RefreshRequest
+		if ctx.Request.ContentLength != 0 {
+			if err := ctx.ShouldBindJSON(&req); err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+				return
+			}
+		}
+		if req.RefreshToken == "" {
+			req.RefreshToken = utils.GetCookieToken(ctx, utils.RefreshTokenCookie)
+			if req.RefreshToken != "" && !utils.ValidCSRF(ctx) {
+				ctx.JSON(http.StatusForbidden, gin.H{"error": "Missing or invalid CSRF token"})
+				return
+			}
+		}
+		if req.RefreshToken == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Refresh token is required"})
+			return
+		}
+		claims, err := utils.ValidateRefreshToken(req.RefreshToken)
+		if err != nil {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		session, err := utils.FindSession(claims.UserID, claims.SessionID)
+		if err == mongo.ErrNoDocuments {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has been revoked"})
 			return
 		}
-		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		var foundUser models.User
-		err := userCollection.FindOne(mongoCtx, bson.M{"email": userLogin.Email}).Decode(&foundUser)
 		if err != nil {
-			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load session", "reasons": err.Error()})
+			return
+		}
+		revoked, err := utils.IsTokenRevoked(claims)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check token revocation"})
+			return
+		}
+		if revoked {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has been revoked"})
 			return
 		}
-		err = bcrypt.CompareHashAndPassword([]byte(foundUser.Password), []byte(userLogin.Password))
+		if session.RefreshTokenHash != utils.HashSecureToken(req.RefreshToken) {
+			// a rotated-out token from a live session means it leaked
+			endLeakedSession(ctx, session)
+			return
+		}
+		foundUser, err := findUserByID(claims.UserID)
 		if err != nil {
-			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
 			return
 		}
-		token, refreshToken, err := utils.GenerateAllTokens(foundUser.Email, foundUser.FirstName, foundUser.LastName, foundUser.UserID, foundUser.Role)
+		// a session started before the account was disabled or scheduled for
+		// deletion must not outlive that; signing in again is the way back
+		if foundUser.DisabledAt != nil || foundUser.DeletionScheduledAt != nil {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Account is not active, please log in again"})
+			return
+		}
+		response, err := generateUserTokens(foundUser, session.SessionID)
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens", "reasons": err.Error()})
 			return
 		}
-		err = utils.UpdateAllTokens(foundUser.UserID, token, refreshToken)
+		rotated, err := utils.RotateSessionToken(session.SessionID, req.RefreshToken, response.RefreshToken)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update session", "reasons": err.Error()})
+			return
+		}
+		if !rotated {
+			endLeakedSession(ctx, session)
+			return
+		}
+		writeTokenResponse(ctx, response)
+	}
+}
+
+// endLeakedSession signs out a session whose refresh token was replayed.
+func endLeakedSession(ctx *gin.Context, session models.Session) {
+	if _, err := utils.DeleteSession(session.UserID, session.SessionID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session", "reasons": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected, please log in again"})
+}
+
+func LogoutUser() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		claims, err := utils.GetClaimsFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Token claims not found in context"})
+			return
+		}
+		if _, err := utils.DeleteSession(claims.UserID, claims.SessionID); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session", "reasons": err.Error()})
+			return
+		}
+		// ending an impersonation must not sign the admin's browser out
+		if config.Env.AUTH_COOKIES_ENABLED && ctx.GetString("impersonatorId") == "" {
+			utils.ClearAuthCookies(ctx)
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+	}
+}
+
+func LogoutAllSessions() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !forbidImpersonation(ctx) {
+			return
+		}
+		claims, err := utils.GetClaimsFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Token claims not found in context"})
+			return
+		}
+		if err := utils.RevokeAllUserTokens(claims.UserID); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens", "reasons": err.Error()})
+			return
+		}
+		if config.Env.AUTH_COOKIES_ENABLED {
+			utils.ClearAuthCookies(ctx)
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Logged out of all sessions"})
+	}
+}
+
+func UnlockUser() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		adminID, err := utils.GetUserIDFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "User Id not found in context"})
+			return
+		}
+		user, err := findUserByID(ctx.Param("user_id"))
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tokens", "reasons": err.Error()})
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 			return
 		}
-		ctx.JSON(http.StatusOK, models.UserResponse{
-			UserID:          foundUser.UserID,
-			FirstName:       foundUser.FirstName,
-			LastName:        foundUser.LastName,
-			Email:           foundUser.Email,
-			Role:            foundUser.Role,
-			Token:           token,
-			RefreshToken:    refreshToken,
-			FavouriteGenres: foundUser.FavouriteGenres,
+		if err := utils.ClearLoginFailures(utils.AccountThrottleKey(user.Email)); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user", "reasons": err.Error()})
+			return
+		}
+		err = utils.RecordAuditEvent(models.AuditEvent{
+			Type:     "login.unlock",
+			ActorID:  adminID,
+			TargetID: user.UserID,
+			IP:       ctx.ClientIP(),
 		})
+		if err != nil {
+			log.Println("Failed to record unlock event:", err)
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "User unlocked"})
 	}
 }
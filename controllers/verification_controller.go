@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ardiannm/go/config"
+	"github.com/ardiannm/go/mailer"
+	"github.com/ardiannm/go/models"
+	"github.com/ardiannm/go/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func sendVerificationEmail(user models.User) error {
+	token, tokenHash, err := utils.GenerateSecureToken()
+	if err != nil {
+		return err
+	}
+	mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	update := bson.M{
+		"$set": bson.M{
+			"email_verification": models.SecretToken{
+				TokenHash: tokenHash,
+				CreatedAt: time.Now(),
+				ExpiresAt: time.Now().Add(time.Duration(config.Env.EMAIL_VERIFICATION_TTL_HOURS) * time.Hour),
+			},
+		},
+	}
+	if _, err := userCollection.UpdateOne(mongoCtx, bson.M{"user_id": user.UserID}, update); err != nil {
+		return err
+	}
+	link := config.Env.API_BASE_URL + "/users/verify?token=" + url.QueryEscape(token)
+	return mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your Gotrock email address",
+		Body: "Hi " + user.FirstName + ",\n\n" +
+			"Please confirm your email address by opening the link below.\n\n" +
+			link + "\n",
+	})
+}
+
+func VerifyEmail() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		token := ctx.Query("token")
+		if token == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Verification token is required"})
+			return
+		}
+		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		filter := bson.M{
+			"email_verification.token_hash": utils.HashSecureToken(token),
+			"email_verification.expires_at": bson.M{"$gt": time.Now()},
+		}
+		update := bson.M{
+			"$set":   bson.M{"email_verified": true, "updated_at": time.Now()},
+			"$unset": bson.M{"email_verification": ""},
+		}
+		result, err := userCollection.UpdateOne(mongoCtx, filter, update)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Verification token is invalid or has expired"})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Email address verified"})
+	}
+}
+
+func ResendVerificationEmail() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req models.ResendVerificationRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "reasons": err.Error()})
+			return
+		}
+		// same answer for unknown, verified and throttled accounts
+		accepted := gin.H{"message": "If the email needs verification, a new link has been sent"}
+		mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		var foundUser models.User
+		err := userCollection.FindOne(mongoCtx, bson.M{"email": req.Email}).Decode(&foundUser)
+		if err == mongo.ErrNoDocuments {
+			ctx.JSON(http.StatusAccepted, accepted)
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up user"})
+			return
+		}
+		if foundUser.EmailVerified {
+			ctx.JSON(http.StatusAccepted, accepted)
+			return
+		}
+		interval := time.Duration(config.Env.EMAIL_VERIFICATION_RESEND_SECONDS) * time.Second
+		if foundUser.EmailVerify != nil && time.Since(foundUser.EmailVerify.CreatedAt) < interval {
+			ctx.JSON(http.StatusAccepted, accepted)
+			return
+		}
+		if err := sendVerificationEmail(foundUser); err != nil {
+			log.Println("Failed to send verification email:", err)
+		}
+		ctx.JSON(http.StatusAccepted, accepted)
+	}
+}
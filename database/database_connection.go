@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/ardiannm/go/config"
 	"go.mongodb.org/mongo-driver/v2/mongo"
@@ -15,17 +16,29 @@ var Client *mongo.Client
 
 func init() {
 	var err error
+	clientOptions := options.Client()
+	// an unset MONGODB_URI is reported by config.Validate; until then the
+	// client keeps the driver defaults, it does not dial before first use
+	if config.Env.MONGODB_URI != "" {
+		clientOptions.ApplyURI(config.Env.MONGODB_URI)
+	}
 	// connect to MongoDB
-	Client, err = mongo.Connect(options.Client().ApplyURI(config.Env.MONGODB_URI))
+	Client, err = mongo.Connect(clientOptions)
 	if err != nil {
 		log.Fatal("Failed to connect to MongoDB:", err)
 	}
-	// ping MongoDB to verify connection
-	if err := Client.Ping(context.Background(), nil); err != nil {
-		log.Fatal("MongoDB ping failed:", err)
+}
+
+// Ping verifies the connection; main calls it before serving.
+func Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := Client.Ping(ctx, nil); err != nil {
+		return err
 	}
 	// report being connected
 	fmt.Println("MongoDB connection established successfully")
+	return nil
 }
 
 // return a collection from the global Client
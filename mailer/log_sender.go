@@ -0,0 +1,32 @@
+package mailer
+
+import (
+	"log"
+	"os"
+	"sync"
+)
+
+// LogSender writes messages to a file, or to the standard logger when Path
+// is empty. Meant for local development.
+type LogSender struct {
+	Path string
+	From string
+	mu   sync.Mutex
+}
+
+func (s *LogSender) Send(msg Message) error {
+	raw := formatMessage(s.From, msg)
+	if s.Path == "" {
+		log.Printf("📧 outgoing mail\n%s\n", raw)
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := os.OpenFile(s.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(raw, []byte("\r\n\r\n")...))
+	return err
+}
@@ -0,0 +1,47 @@
+package mailer
+
+import (
+	"log"
+
+	"github.com/ardiannm/go/config"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers outgoing email. Implementations must be safe for
+// concurrent use.
+type Sender interface {
+	Send(msg Message) error
+}
+
+// Default is the sender selected by MAIL_DRIVER
+var Default Sender = newDefaultSender()
+
+func newDefaultSender() Sender {
+	switch config.Env.MAIL_DRIVER {
+	case "smtp":
+		if config.Env.SMTP_HOST == "" {
+			log.Fatal("❌ SMTP_HOST is required when MAIL_DRIVER is smtp")
+		}
+		return &SMTPSender{
+			Host:     config.Env.SMTP_HOST,
+			Port:     config.Env.SMTP_PORT,
+			Username: config.Env.SMTP_USERNAME,
+			Password: config.Env.SMTP_PASSWORD,
+			From:     config.Env.MAIL_FROM,
+		}
+	case "log":
+		return &LogSender{Path: config.Env.MAIL_LOG_FILE, From: config.Env.MAIL_FROM}
+	default:
+		log.Fatalf("❌ Unsupported MAIL_DRIVER: %s", config.Env.MAIL_DRIVER)
+		return nil
+	}
+}
+
+func Send(msg Message) error {
+	return Default.Send(msg)
+}
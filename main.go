@@ -2,14 +2,48 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"time"
 
+	"github.com/ardiannm/go/commands"
+	"github.com/ardiannm/go/config"
+	"github.com/ardiannm/go/database"
 	"github.com/ardiannm/go/routes"
+	"github.com/ardiannm/go/utils"
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
 
+	if err := config.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if err := database.Ping(); err != nil {
+		log.Fatal("MongoDB ping failed:", err)
+	}
+
+	if len(os.Args) > 1 {
+		if err := commands.Run(os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if config.Env.ENSURE_INDEXES_ON_STARTUP {
+		if _, err := utils.EnsureIndexes(); err != nil {
+			log.Fatal("Failed to create indexes:", err)
+		}
+	}
+	if err := utils.EnsureDefaultRoles(); err != nil {
+		log.Fatal("Failed to create default roles:", err)
+	}
+
+	go utils.RunAccountPurge(time.Hour)
+	go utils.RunDataExportWorker(10 * time.Second)
+	go utils.RunMovieSearchRefresh(time.Duration(config.Env.MOVIE_SEARCH_REFRESH_SECONDS) * time.Second)
+
 	router := gin.Default()
 
 	router.GET("/hello", func(ctx *gin.Context) {
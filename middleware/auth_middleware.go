@@ -3,17 +3,27 @@ package middleware
 import (
 	"net/http"
 
+	"github.com/ardiannm/go/models"
 	"github.com/ardiannm/go/utils"
 	"github.com/gin-gonic/gin"
 )
 
 func AuthMiddleware() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
+		if key := utils.GetAPIKey(ctx); key != "" {
+			authenticateAPIKey(ctx, key)
+			return
+		}
 		token, err := utils.GetAccessToken(ctx)
 		if err != nil {
-			ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
-			ctx.Abort()
-			return
+			cookie := utils.GetCookieToken(ctx, utils.AccessTokenCookie)
+			if cookie == "" {
+				ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				ctx.Abort()
+				return
+			}
+			token = cookie
+			ctx.Set("authSource", "cookie")
 		}
 		if token == "" {
 			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "No token provided"})
@@ -26,8 +36,66 @@ func AuthMiddleware() gin.HandlerFunc {
 			ctx.Abort()
 			return
 		}
+		revoked, err := utils.IsTokenRevoked(claims)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check token revocation"})
+			ctx.Abort()
+			return
+		}
+		if revoked {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			ctx.Abort()
+			return
+		}
+		active, err := utils.IsSessionActive(claims)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check session"})
+			ctx.Abort()
+			return
+		}
+		if !active {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Session has ended"})
+			ctx.Abort()
+			return
+		}
+		ctx.Set("claims", claims)
 		ctx.Set("userId", claims.UserID)
+		ctx.Set("sessionId", claims.SessionID)
+		if claims.ImpersonatorID != "" {
+			ctx.Set("impersonatorId", claims.ImpersonatorID)
+		}
 		ctx.Set("role", claims.Role)
+		roles := claims.Roles
+		if len(roles) == 0 && claims.Role != "" {
+			roles = []models.UserRole{claims.Role}
+		}
+		ctx.Set("roles", roles)
+		permissions := claims.Permissions
+		if permissions == nil {
+			permissions = []models.Permission{}
+		}
+		ctx.Set("permissions", permissions)
 		ctx.Next()
 	}
 }
+
+func authenticateAPIKey(ctx *gin.Context, key string) {
+	apiKey, err := utils.AuthenticateAPIKey(key)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		ctx.Abort()
+		return
+	}
+	roles, permissions, err := utils.APIKeyGrant(apiKey)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		ctx.Abort()
+		return
+	}
+	ctx.Set("apiKeyId", apiKey.KeyID)
+	ctx.Set("userId", apiKey.UserID)
+	ctx.Set("role", utils.PrimaryRole(roles))
+	ctx.Set("roles", roles)
+	ctx.Set("permissions", permissions)
+	ctx.Next()
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"log"
+
+	"github.com/ardiannm/go/models"
+	"github.com/ardiannm/go/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// ImpersonationAuditMiddleware marks responses to impersonation tokens and
+// records every such request in the audit log once it has been handled.
+func ImpersonationAuditMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		impersonatorID := ctx.GetString("impersonatorId")
+		if impersonatorID == "" {
+			ctx.Next()
+			return
+		}
+		ctx.Header("X-Impersonated-By", impersonatorID)
+		ctx.Next()
+		err := utils.RecordAuditEvent(models.AuditEvent{
+			Type:     "impersonation.request",
+			ActorID:  impersonatorID,
+			TargetID: ctx.GetString("userId"),
+			IP:       ctx.ClientIP(),
+			Details: bson.M{
+				"method":     ctx.Request.Method,
+				"path":       ctx.Request.URL.Path,
+				"query":      ctx.Request.URL.RawQuery,
+				"status":     ctx.Writer.Status(),
+				"session_id": ctx.GetString("sessionId"),
+			},
+		})
+		if err != nil {
+			log.Println("Failed to record impersonated request:", err)
+		}
+	}
+}
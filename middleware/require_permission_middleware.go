@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/ardiannm/go/models"
+	"github.com/ardiannm/go/utils"
+	"github.com/gin-gonic/gin"
+)
+
+func RequirePermission(permission models.Permission) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		permissions, err := utils.GetPermissionsFromContext(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "User permissions not found"})
+			ctx.Abort()
+			return
+		}
+		if !slices.Contains(permissions, permission) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Forbidden", "missing_permission": permission})
+			ctx.Abort()
+			return
+		}
+		ctx.Next()
+	}
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"net/http"
+	"slices"
 
 	"github.com/ardiannm/go/models"
 	"github.com/ardiannm/go/utils"
@@ -10,13 +11,13 @@ import (
 
 func RequireRole(role models.UserRole) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		userRole, err := utils.GetUserRoleFromContext(ctx)
+		userRoles, err := utils.GetUserRolesFromContext(ctx)
 		if err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "User role not found"})
 			ctx.Abort()
 			return
 		}
-		if userRole != role {
+		if !slices.Contains(userRoles, role) {
 			ctx.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
 			ctx.Abort()
 			return
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// APIKey lets a machine client act as its owner, limited to Scopes. Only a
+// hash of the key is stored; Prefix identifies it in listings and lookups.
+type APIKey struct {
+	ID         bson.ObjectID `bson:"_id,omitempty" json:"-"`
+	KeyID      string        `bson:"key_id" json:"key_id"`
+	UserID     string        `bson:"user_id" json:"user_id"`
+	Name       string        `bson:"name" json:"name"`
+	Prefix     string        `bson:"prefix" json:"prefix"`
+	KeyHash    string        `bson:"key_hash" json:"-"`
+	Scopes     []Permission  `bson:"scopes" json:"scopes"`
+	CreatedAt  time.Time     `bson:"created_at" json:"created_at"`
+	LastUsedAt *time.Time    `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time    `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+}
+
+type APIKeyRequest struct {
+	Name   string       `json:"name" validate:"required,min=1,max=100"`
+	Scopes []Permission `json:"scopes"`
+}
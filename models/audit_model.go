@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type AuditEvent struct {
+	ID        bson.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	Type      string        `bson:"type" json:"type"`
+	ActorID   string        `bson:"actor_id,omitempty" json:"actor_id,omitempty"`
+	TargetID  string        `bson:"target_id,omitempty" json:"target_id,omitempty"`
+	IP        string        `bson:"ip,omitempty" json:"ip,omitempty"`
+	Details   bson.M        `bson:"details,omitempty" json:"details,omitempty"`
+	CreatedAt time.Time     `bson:"created_at" json:"created_at"`
+}
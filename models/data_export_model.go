@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// DataExport is a request for a copy of everything stored about a user. The
+// export worker fills in Archive, a ZIP file, and the document is dropped by
+// a TTL index once ExpiresAt passes.
+type DataExport struct {
+	ID          bson.ObjectID `bson:"_id,omitempty" json:"-"`
+	ExportID    string        `bson:"export_id" json:"export_id"`
+	UserID      string        `bson:"user_id" json:"user_id"`
+	RequestedBy string        `bson:"requested_by" json:"requested_by"`
+	Status      string        `bson:"status" json:"status"`
+	Error       string        `bson:"error,omitempty" json:"error,omitempty"`
+	Archive     []byte        `bson:"archive,omitempty" json:"-"`
+	Size        int           `bson:"size,omitempty" json:"size,omitempty"`
+	SHA256      string        `bson:"sha256,omitempty" json:"sha256,omitempty"`
+	CreatedAt   time.Time     `bson:"created_at" json:"created_at"`
+	StartedAt   *time.Time    `bson:"started_at,omitempty" json:"started_at,omitempty"`
+	CompletedAt *time.Time    `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+	ExpiresAt   time.Time     `bson:"expires_at" json:"expires_at"`
+}
+
+// ErasureStep records what erasure did to one collection.
+type ErasureStep struct {
+	Collection string `bson:"collection" json:"collection"`
+	Action     string `bson:"action" json:"action"`
+	Count      int64  `bson:"count" json:"count"`
+}
+
+// ErasureRecord is kept after a user's data has been erased. It names the
+// subject only by a hash of their user_id, so whoever holds the id can check
+// that the erasure happened without the record identifying anyone by
+// itself. Remaining counts what still referenced the user afterwards and
+// should be zero everywhere.
+type ErasureRecord struct {
+	ID          bson.ObjectID    `bson:"_id,omitempty" json:"-"`
+	ErasureID   string           `bson:"erasure_id" json:"erasure_id"`
+	SubjectHash string           `bson:"subject_hash" json:"subject_hash"`
+	RequestedBy string           `bson:"requested_by" json:"requested_by"`
+	Reason      string           `bson:"reason" json:"reason"`
+	Steps       []ErasureStep    `bson:"steps" json:"steps"`
+	Remaining   map[string]int64 `bson:"remaining" json:"remaining"`
+	Verified    bool             `bson:"verified" json:"verified"`
+	StartedAt   time.Time        `bson:"started_at" json:"started_at"`
+	CompletedAt time.Time        `bson:"completed_at" json:"completed_at"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Invitation admits up to MaxUses registrations while sign-up is invitation
+// only. Only a hash of the code is stored. When Email is set only that
+// address may redeem it; Role is granted on top of USER.
+type Invitation struct {
+	ID           bson.ObjectID          `bson:"_id,omitempty" json:"-"`
+	InvitationID string                 `bson:"invitation_id" json:"invitation_id"`
+	CodeHash     string                 `bson:"code_hash" json:"-"`
+	CreatedBy    string                 `bson:"created_by" json:"created_by"`
+	Email        string                 `bson:"email" json:"email,omitempty"`
+	Role         UserRole               `bson:"role,omitempty" json:"role,omitempty"`
+	MaxUses      int                    `bson:"max_uses" json:"max_uses"`
+	Uses         int                    `bson:"uses" json:"uses"`
+	Redemptions  []InvitationRedemption `bson:"redemptions" json:"-"`
+	CreatedAt    time.Time              `bson:"created_at" json:"created_at"`
+	ExpiresAt    time.Time              `bson:"expires_at" json:"expires_at"`
+	RevokedAt    *time.Time             `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+}
+
+type InvitationRedemption struct {
+	UserID     string    `bson:"user_id" json:"user_id"`
+	Email      string    `bson:"email" json:"email"`
+	IP         string    `bson:"ip" json:"ip"`
+	RedeemedAt time.Time `bson:"redeemed_at" json:"redeemed_at"`
+}
+
+type InvitationRequest struct {
+	Email          string   `json:"email" validate:"omitempty,email"`
+	Role           UserRole `json:"role"`
+	MaxUses        int      `json:"max_uses" validate:"omitempty,min=1,max=1000"`
+	ExpiresInHours int      `json:"expires_in_hours" validate:"omitempty,min=1,max=8760"`
+}
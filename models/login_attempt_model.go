@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// LoginAttempt counts recent failed logins for one key, either an account
+// ("account:<email>") or a client address ("ip:<address>").
+type LoginAttempt struct {
+	Key           string    `bson:"key" json:"key"`
+	Failures      int64     `bson:"failures" json:"failures"`
+	LastFailureAt time.Time `bson:"last_failure_at" json:"last_failure_at"`
+	LockedUntil   time.Time `bson:"locked_until,omitempty" json:"locked_until,omitempty"`
+	ExpiresAt     time.Time `bson:"expires_at" json:"expires_at"`
+}
@@ -23,4 +23,15 @@ type Movie struct {
 	Genre       []Genre       `bson:"genre" json:"genre" validate:"required,dive"`
 	AdminReview string        `bson:"admin_review" json:"admin_review" validate:"required"`
 	Ranking     Ranking       `bson:"ranking" json:"ranking" validate:"required"`
+	// Version goes up by one with every change and is served as the ETag;
+	// movies stored before versioning read as version 0
+	Version int64 `bson:"version" json:"version"`
+}
+
+// MovieSearchResult is one hit of a movie search. Highlights holds
+// HTML-escaped snippets of the matching fields with the matches in <mark>.
+type MovieSearchResult struct {
+	Movie      Movie             `json:"movie"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
 }
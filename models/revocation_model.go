@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// RevokedToken invalidates every token a user was issued before
+// RevokedBefore. Single sessions are revoked by deleting their Session.
+// Entries are dropped by a TTL index once ExpiresAt passes.
+type RevokedToken struct {
+	UserID        string    `bson:"user_id" json:"user_id"`
+	RevokedBefore time.Time `bson:"revoked_before" json:"revoked_before"`
+	ExpiresAt     time.Time `bson:"expires_at" json:"expires_at"`
+}
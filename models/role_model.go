@@ -0,0 +1,61 @@
+package models
+
+import (
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type Permission string
+
+const (
+	PermMoviesCreate Permission = "movies:create"
+	PermMoviesUpdate Permission = "movies:update"
+	PermMoviesDelete Permission = "movies:delete"
+	PermReviewsWrite Permission = "reviews:write"
+	PermUsersRead    Permission = "users:read"
+	PermUsersManage  Permission = "users:manage"
+	PermRolesManage  Permission = "roles:manage"
+	// lets support staff act as a user; see ImpersonateUser
+	PermUsersImpersonate Permission = "users:impersonate"
+)
+
+// AllPermissions lists every permission the API checks. ADMIN always holds
+// all of them.
+var AllPermissions = []Permission{
+	PermMoviesCreate,
+	PermMoviesUpdate,
+	PermMoviesDelete,
+	PermReviewsWrite,
+	PermUsersRead,
+	PermUsersManage,
+	PermRolesManage,
+	PermUsersImpersonate,
+}
+
+func (p Permission) IsValid() bool {
+	return slices.Contains(AllPermissions, p)
+}
+
+// Role is a named permission set stored in the roles collection.
+type Role struct {
+	ID          bson.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	Name        UserRole      `bson:"name" json:"name"`
+	Description string        `bson:"description" json:"description"`
+	Permissions []Permission  `bson:"permissions" json:"permissions"`
+	BuiltIn     bool          `bson:"built_in" json:"built_in"`
+	CreatedAt   time.Time     `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time     `bson:"updated_at" json:"updated_at"`
+}
+
+// DefaultRoles are created on startup when missing and cannot be deleted.
+var DefaultRoles = []Role{
+	{Name: USER, Description: "Registered user", Permissions: []Permission{}, BuiltIn: true},
+	{Name: ADMIN, Description: "Full access", Permissions: AllPermissions, BuiltIn: true},
+}
+
+type RoleDefinition struct {
+	Description string       `json:"description" validate:"max=200"`
+	Permissions []Permission `json:"permissions" validate:"required"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Session is one signed-in device. Every access and refresh token issued for
+// it carries SessionID, and deleting the session invalidates them all. Only
+// a hash of the current refresh token is stored.
+type Session struct {
+	ID               bson.ObjectID `bson:"_id,omitempty" json:"-"`
+	SessionID        string        `bson:"session_id" json:"session_id"`
+	UserID           string        `bson:"user_id" json:"-"`
+	DeviceLabel      string        `bson:"device_label" json:"device_label"`
+	UserAgent        string        `bson:"user_agent" json:"user_agent"`
+	IP               string        `bson:"ip" json:"ip"`
+	RefreshTokenHash string        `bson:"refresh_token_hash" json:"-"`
+	CreatedAt        time.Time     `bson:"created_at" json:"created_at"`
+	LastSeenAt       time.Time     `bson:"last_seen_at" json:"last_seen_at"`
+	ExpiresAt        time.Time     `bson:"expires_at" json:"expires_at"`
+	// set on the short-lived sessions an admin opens to act as the user
+	ImpersonatorID string `bson:"impersonator_id,omitempty" json:"impersonator_id,omitempty"`
+	// Current marks the session the listing was requested from
+	Current bool `bson:"-" json:"current"`
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"slices"
 	"time"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
@@ -14,18 +15,71 @@ const (
 )
 
 type User struct {
-	ID              bson.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
-	UserID          string        `bson:"user_id" json:"user_id"`
-	FirstName       string        `bson:"first_name" json:"first_name" validate:"required,min=2,max=100"`
-	LastName        string        `bson:"last_name" json:"last_name" validate:"required,min=2,max=100"`
-	Email           string        `bson:"email" json:"email" validate:"required,email"`
-	Password        string        `bson:"password" json:"password" validate:"required,min=6"`
-	Role            UserRole      `bson:"role" json:"role" validate:"oneof=ADMIN USER"`
-	CreatedAt       time.Time     `bson:"created_at" json:"created_at"`
-	UpdatedAt       time.Time     `bson:"updated_at" json:"updated_at"`
-	Token           string        `bson:"token" json:"token"`
-	RefreshToken    string        `bson:"refresh_token" json:"refresh_token"`
-	FavouriteGenres []Genre       `bson:"favourite_genres" json:"favourite_genres" validate:"required,dive"`
+	ID              bson.ObjectID      `bson:"_id,omitempty" json:"_id,omitempty"`
+	UserID          string             `bson:"user_id" json:"user_id"`
+	FirstName       string             `bson:"first_name" json:"first_name" validate:"required,min=2,max=100"`
+	LastName        string             `bson:"last_name" json:"last_name" validate:"required,min=2,max=100"`
+	Email           string             `bson:"email" json:"email" validate:"required,email"`
+	EmailVerified   bool               `bson:"email_verified" json:"email_verified"`
+	Password        string             `bson:"password" json:"password" validate:"required,min=6"`
+	Roles           []UserRole         `bson:"roles" json:"roles"`
+	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt       time.Time          `bson:"updated_at" json:"updated_at"`
+	PasswordReset   *SecretToken       `bson:"password_reset,omitempty" json:"-"`
+	EmailVerify     *SecretToken       `bson:"email_verification,omitempty" json:"-"`
+	TwoFactor       *TwoFactor         `bson:"two_factor,omitempty" json:"-"`
+	FavouriteGenres []Genre            `bson:"favourite_genres" json:"favourite_genres" validate:"required,dive"`
+	Identities      []ExternalIdentity `bson:"identities,omitempty" json:"-"`
+	// set while a requested account deletion is in its grace period
+	DeletionScheduledAt *time.Time `bson:"deletion_scheduled_at,omitempty" json:"deletion_scheduled_at,omitempty"`
+	// set by an admin to block sign-in until the account is re-enabled
+	DisabledAt     *time.Time `bson:"disabled_at,omitempty" json:"disabled_at,omitempty"`
+	DisabledReason string     `bson:"disabled_reason,omitempty" json:"disabled_reason,omitempty"`
+	// Role is the single role stored before users could hold several; it is
+	// only read when Roles is empty
+	Role UserRole `bson:"role,omitempty" json:"-"`
+}
+
+// SecretToken is a single-use token stored by hash only
+type SecretToken struct {
+	TokenHash string    `bson:"token_hash" json:"-"`
+	CreatedAt time.Time `bson:"created_at" json:"-"`
+	ExpiresAt time.Time `bson:"expires_at" json:"-"`
+}
+
+// TwoFactor holds the TOTP enrollment of a user. PendingSecret is set
+// between setup and confirmation; RecoveryCodes are stored hashed.
+type TwoFactor struct {
+	Enabled       bool      `bson:"enabled"`
+	Secret        string    `bson:"secret,omitempty"`
+	PendingSecret string    `bson:"pending_secret,omitempty"`
+	LastUsedStep  int64     `bson:"last_used_step"`
+	RecoveryCodes []string  `bson:"recovery_codes,omitempty"`
+	EnabledAt     time.Time `bson:"enabled_at,omitempty"`
+}
+
+func (u User) TwoFactorEnabled() bool {
+	return u.TwoFactor != nil && u.TwoFactor.Enabled
+}
+
+func (u User) RoleNames() []UserRole {
+	if len(u.Roles) == 0 && u.Role != "" {
+		return []UserRole{u.Role}
+	}
+	return u.Roles
+}
+
+func (u User) HasRole(role UserRole) bool {
+	return slices.Contains(u.RoleNames(), role)
+}
+
+type UserRegistration struct {
+	FirstName       string  `json:"first_name" validate:"required,min=2,max=100"`
+	LastName        string  `json:"last_name" validate:"required,min=2,max=100"`
+	Email           string  `json:"email" validate:"required,email"`
+	Password        string  `json:"password" validate:"required"`
+	FavouriteGenres []Genre `json:"favourite_genres" validate:"required,dive"`
+	InvitationCode  string  `json:"invitation_code"`
 }
 
 type UserLogin struct {
@@ -33,13 +87,131 @@ type UserLogin struct {
 	Password string `json:"password" validate:"required,min=6"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code         string `json:"code" validate:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required_without=RecoveryCode"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// UpdateProfileRequest is a partial update; omitted fields are left as they are
+type UpdateProfileRequest struct {
+	FirstName       *string  `json:"first_name" validate:"omitempty,min=2,max=100"`
+	LastName        *string  `json:"last_name" validate:"omitempty,min=2,max=100"`
+	FavouriteGenres *[]Genre `json:"favourite_genres" validate:"omitempty,dive"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+// UserProfile is what a user sees of their own account; it never carries
+// secrets.
+type UserProfile struct {
+	UserID              string     `json:"user_id"`
+	FirstName           string     `json:"first_name"`
+	LastName            string     `json:"last_name"`
+	Email               string     `json:"email"`
+	EmailVerified       bool       `json:"email_verified"`
+	Roles               []UserRole `json:"roles"`
+	FavouriteGenres     []Genre    `json:"favourite_genres"`
+	HasPassword         bool       `json:"has_password"`
+	TwoFactorEnabled    bool       `json:"two_factor_enabled"`
+	LinkedProviders     []string   `json:"linked_providers"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+}
+
+func (u User) Profile() UserProfile {
+	providers := []string{}
+	for _, identity := range u.Identities {
+		providers = append(providers, identity.Provider)
+	}
+	genres := u.FavouriteGenres
+	if genres == nil {
+		genres = []Genre{}
+	}
+	return UserProfile{
+		UserID:              u.UserID,
+		FirstName:           u.FirstName,
+		LastName:            u.LastName,
+		Email:               u.Email,
+		EmailVerified:       u.EmailVerified,
+		Roles:               u.RoleNames(),
+		FavouriteGenres:     genres,
+		HasPassword:         u.Password != "",
+		TwoFactorEnabled:    u.TwoFactorEnabled(),
+		LinkedProviders:     providers,
+		CreatedAt:           u.CreatedAt,
+		UpdatedAt:           u.UpdatedAt,
+		DeletionScheduledAt: u.DeletionScheduledAt,
+	}
+}
+
+// AdminUserView is what admins see of an account; like UserProfile it never
+// carries secrets.
+type AdminUserView struct {
+	UserProfile
+	DisabledAt     *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason string     `json:"disabled_reason,omitempty"`
+}
+
+func (u User) AdminView() AdminUserView {
+	return AdminUserView{
+		UserProfile:    u.Profile(),
+		DisabledAt:     u.DisabledAt,
+		DisabledReason: u.DisabledReason,
+	}
+}
+
+type DisableUserRequest struct {
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+type ImpersonationRequest struct {
+	Reason string `json:"reason" validate:"required,min=3,max=500"`
+}
+
 type UserResponse struct {
-	UserID          string   `json:"user_id"`
-	FirstName       string   `json:"first_name"`
-	LastName        string   `json:"last_name"`
-	Email           string   `json:"email"`
-	Role            UserRole `json:"role"`
-	Token           string   `json:"token"`
-	RefreshToken    string   `json:"refresh_token"`
-	FavouriteGenres []Genre  `json:"favourite_genre"`
+	UserID          string       `json:"user_id"`
+	FirstName       string       `json:"first_name"`
+	LastName        string       `json:"last_name"`
+	Email           string       `json:"email"`
+	EmailVerified   bool         `json:"email_verified"`
+	Role            UserRole     `json:"role"`
+	Roles           []UserRole   `json:"roles"`
+	Permissions     []Permission `json:"permissions"`
+	Token           string       `json:"token,omitempty"`
+	RefreshToken    string       `json:"refresh_token,omitempty"`
+	CSRFToken       string       `json:"csrf_token,omitempty"`
+	FavouriteGenres []Genre      `json:"favourite_genre"`
+	// set for admins whose tokens carry USER until they enroll in 2FA
+	TwoFactorEnrollmentRequired bool `json:"two_factor_enrollment_required,omitempty"`
 }
@@ -9,11 +9,49 @@ import (
 
 func SetupProtectedRoutes(router *gin.Engine) {
 	router.Use(middleware.AuthMiddleware())
+	router.Use(middleware.CSRFMiddleware())
+	router.Use(middleware.ImpersonationAuditMiddleware())
 
-	router.GET("/users", controllers.GetUsers())
+	router.GET("/users", middleware.RequirePermission(models.PermUsersRead), controllers.GetUsers())
+	router.POST("/users/logout", controllers.LogoutUser())
+	router.POST("/users/logout-all", controllers.LogoutAllSessions())
+	router.GET("/users/me", controllers.GetProfile())
+	router.PATCH("/users/me", controllers.UpdateProfile())
+	router.DELETE("/users/me", controllers.DeleteAccount())
+	router.POST("/users/me/password", controllers.ChangePassword())
+	router.POST("/users/me/export", controllers.RequestDataExport())
+	router.GET("/exports/:export_id", controllers.GetDataExport())
+	router.GET("/exports/:export_id/download", controllers.DownloadDataExport())
+	router.POST("/users/me/2fa/setup", controllers.SetupTwoFactor())
+	router.POST("/users/me/2fa/confirm", controllers.ConfirmTwoFactor())
+	router.POST("/users/me/2fa/disable", controllers.DisableTwoFactor())
+	router.POST("/users/me/api-keys", controllers.CreateAPIKey())
+	router.GET("/users/me/api-keys", controllers.GetAPIKeys())
+	router.DELETE("/users/me/api-keys/:key_id", controllers.RevokeAPIKey())
+	router.GET("/users/me/sessions", controllers.GetSessions())
+	router.DELETE("/users/me/sessions/:session_id", controllers.RevokeSession())
+	router.GET("/users/:user_id", middleware.RequirePermission(models.PermUsersRead), controllers.GetUser())
+	router.POST("/users/:user_id/disable", middleware.RequirePermission(models.PermUsersManage), controllers.DisableUser())
+	router.POST("/users/:user_id/enable", middleware.RequirePermission(models.PermUsersManage), controllers.EnableUser())
+	router.DELETE("/users/:user_id", middleware.RequirePermission(models.PermUsersManage), controllers.DeleteUser())
+	router.POST("/users/:user_id/export", middleware.RequirePermission(models.PermUsersManage), controllers.RequestUserDataExport())
+	router.GET("/erasures/:erasure_id", middleware.RequirePermission(models.PermUsersManage), controllers.GetErasureRecord())
+	router.POST("/users/:user_id/impersonate", middleware.RequirePermission(models.PermUsersImpersonate), controllers.ImpersonateUser())
+	router.POST("/users/:user_id/unlock", middleware.RequirePermission(models.PermUsersManage), controllers.UnlockUser())
+	router.POST("/users/:user_id/roles/:role", middleware.RequirePermission(models.PermRolesManage), controllers.GrantUserRole())
+	router.DELETE("/users/:user_id/roles/:role", middleware.RequirePermission(models.PermRolesManage), controllers.RevokeUserRole())
+	router.POST("/invitations", middleware.RequirePermission(models.PermUsersManage), controllers.CreateInvitation())
+	router.GET("/invitations", middleware.RequirePermission(models.PermUsersManage), controllers.GetInvitations())
+	router.DELETE("/invitations/:invitation_id", middleware.RequirePermission(models.PermUsersManage), controllers.RevokeInvitation())
+	router.GET("/invitations/:invitation_id/redemptions", middleware.RequirePermission(models.PermUsersManage), controllers.GetInvitationRedemptions())
+	router.GET("/roles", middleware.RequirePermission(models.PermRolesManage), controllers.GetRoles())
+	router.PUT("/roles/:name", middleware.RequirePermission(models.PermRolesManage), controllers.PutRole())
+	router.DELETE("/roles/:name", middleware.RequirePermission(models.PermRolesManage), controllers.DeleteRole())
 	router.GET("/movies/:imdb_id", controllers.GetMovie())
-	router.POST("/movies", controllers.AddMovie())
-	router.DELETE("/movies/:imdb_id", controllers.DeleteMovieByIMDBID())
+	router.POST("/movies", middleware.RequirePermission(models.PermMoviesCreate), controllers.AddMovie())
+	router.PUT("/movies/:imdb_id", middleware.RequirePermission(models.PermMoviesUpdate), controllers.ReplaceMovie())
+	router.PATCH("/movies/:imdb_id", middleware.RequirePermission(models.PermMoviesUpdate), controllers.PatchMovie())
+	router.DELETE("/movies/:imdb_id", middleware.RequirePermission(models.PermMoviesDelete), controllers.DeleteMovieByIMDBID())
 	router.GET("/movies/recommanded", controllers.GetRecommendedMovies())
-	router.PATCH("/movies/review/:imdb_id", middleware.RequireRole(models.ADMIN), controllers.AdminReviewUpdate())
+	router.PATCH("/movies/review/:imdb_id", middleware.RequirePermission(models.PermReviewsWrite), controllers.AdminReviewUpdate())
 }
@@ -6,7 +6,17 @@ import (
 )
 
 func SetupUnprotectedRoutes(router *gin.Engine) {
+	router.GET("/.well-known/jwks.json", controllers.GetJWKS())
 	router.GET("/movies", controllers.GetMovies())
+	router.GET("/movies/search", controllers.SearchMovies())
 	router.POST("/users", controllers.RegisterUser())
 	router.POST("/users/login", controllers.LoginUser())
+	router.POST("/users/login/2fa", controllers.LoginTwoFactor())
+	router.POST("/users/refresh", controllers.RefreshToken())
+	router.GET("/auth/oidc/:provider/login", controllers.OIDCLogin())
+	router.GET("/auth/oidc/:provider/callback", controllers.OIDCCallback())
+	router.GET("/users/verify", controllers.VerifyEmail())
+	router.POST("/users/verify/resend", controllers.ResendVerificationEmail())
+	router.POST("/users/password/forgot", controllers.ForgotPassword())
+	router.POST("/users/password/reset", controllers.ResetPassword())
 }
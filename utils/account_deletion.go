@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ardiannm/go/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// PurgeDeletedAccounts erases every account whose deletion grace period has
+// ended and returns how many were erased.
+func PurgeDeletedAccounts() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	filter := bson.M{"deletion_scheduled_at": bson.M{"$lte": time.Now()}}
+	cursor, err := userCollection.Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, user := range users {
+		// the filter is repeated so an account restored meanwhile survives
+		filter := bson.M{"user_id": user.UserID, "deletion_scheduled_at": bson.M{"$lte": time.Now()}}
+		record, err := eraseUser(filter, user.UserID, "self", "account deletion requested by the user")
+		if err != nil {
+			return purged, err
+		}
+		if record != nil {
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// RunAccountPurge calls PurgeDeletedAccounts every interval, forever.
+func RunAccountPurge(interval time.Duration) {
+	for {
+		if purged, err := PurgeDeletedAccounts(); err != nil {
+			log.Println("Failed to purge deleted accounts:", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d deleted accounts\n", purged)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ardiannm/go/database"
+	"github.com/ardiannm/go/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const apiKeyMarker = "gtk_"
+
+// how stale an API key's last_used_at may get; it only tells owners which
+// keys are still in use, so minute precision is plenty
+const apiKeyTouchInterval = time.Minute
+
+var apiKeyCollection *mongo.Collection = database.OpenCollection("api_keys")
+
+// GenerateAPIKey returns a new key of the form gtk_<prefix>_<secret>, the
+// public prefix used to find it again and the hash to store.
+func GenerateAPIKey() (string, string, string, error) {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", "", err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+	prefix := apiKeyMarker + hex.EncodeToString(id)
+	key := prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	return key, prefix, HashSecureToken(key), nil
+}
+
+// GetAPIKey reads a key from X-API-Key or an "Authorization: ApiKey" header.
+func GetAPIKey(ctx *gin.Context) string {
+	if key := ctx.Request.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if key, ok := strings.CutPrefix(ctx.Request.Header.Get("Authorization"), "ApiKey "); ok {
+		return strings.TrimSpace(key)
+	}
+	return ""
+}
+
+func AuthenticateAPIKey(key string) (*models.APIKey, error) {
+	if !strings.HasPrefix(key, apiKeyMarker) {
+		return nil, errors.New("Malformed API key")
+	}
+	prefix, _, found := strings.Cut(key[len(apiKeyMarker):], "_")
+	if !found {
+		return nil, errors.New("Malformed API key")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var apiKey models.APIKey
+	filter := bson.M{"prefix": apiKeyMarker + prefix, "revoked_at": bson.M{"$exists": false}}
+	if err := apiKeyCollection.FindOne(ctx, filter).Decode(&apiKey); err != nil {
+		return nil, errors.New("Invalid API key")
+	}
+	if subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(HashSecureToken(key))) != 1 {
+		return nil, errors.New("Invalid API key")
+	}
+	if apiKey.LastUsedAt != nil && time.Since(*apiKey.LastUsedAt) < apiKeyTouchInterval {
+		return &apiKey, nil
+	}
+	now := time.Now()
+	_, err := apiKeyCollection.UpdateOne(ctx, bson.M{"key_id": apiKey.KeyID}, bson.M{"$set": bson.M{"last_used_at": now}})
+	if err != nil {
+		// the key is valid; a missed bookkeeping write is no reason to refuse it
+		log.Println("Failed to record API key use:", err)
+		return &apiKey, nil
+	}
+	apiKey.LastUsedAt = &now
+	return &apiKey, nil
+}
+
+// APIKeyGrant resolves the roles of the key's owner and the permissions the
+// key may exercise on their behalf.
+func APIKeyGrant(apiKey *models.APIKey) ([]models.UserRole, []models.Permission, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": apiKey.UserID}).Decode(&user); err != nil {
+		return nil, nil, err
+	}
+	if user.DisabledAt != nil || user.DeletionScheduledAt != nil {
+		return nil, nil, errors.New("Account is not active")
+	}
+	roles := EffectiveRoles(user)
+	granted, err := ResolvePermissions(roles)
+	if err != nil {
+		return nil, nil, err
+	}
+	return roles, ScopePermissions(granted, apiKey.Scopes), nil
+}
+
+// ScopePermissions limits what the owner may do to what the key was granted.
+func ScopePermissions(granted, scopes []models.Permission) []models.Permission {
+	permissions := []models.Permission{}
+	for _, permission := range granted {
+		if slices.Contains(scopes, permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
+}
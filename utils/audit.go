@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"context"
+	"time"
+
+	"github.com/ardiannm/go/database"
+	"github.com/ardiannm/go/models"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+var auditCollection *mongo.Collection = database.OpenCollection("audit_events")
+
+func RecordAuditEvent(event models.AuditEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	_, err := auditCollection.InsertOne(ctx, event)
+	return err
+}
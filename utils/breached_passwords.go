@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ardiannm/go/config"
+)
+
+// BreachedPasswordList looks passwords up in an offline copy of a breached
+// password corpus such as the Have I Been Pwned SHA-1 list "ordered by hash".
+// The file holds one "SHA1:COUNT" line per password, sorted by hash. Lookups
+// work like the k-anonymity range API: only the first five hex characters of
+// the hash select a bucket, which is then searched for the rest.
+type BreachedPasswordList struct {
+	file *os.File
+	size int64
+}
+
+var breachedPasswords *BreachedPasswordList = mustOpenBreachedPasswords()
+
+func mustOpenBreachedPasswords() *BreachedPasswordList {
+	if config.Env.BREACHED_PASSWORDS_FILE == "" {
+		return nil
+	}
+	list, err := OpenBreachedPasswordList(config.Env.BREACHED_PASSWORDS_FILE)
+	if err != nil {
+		log.Fatalf("❌ Failed to open breached password list: %v", err)
+	}
+	return list
+}
+
+func OpenBreachedPasswordList(path string) (*BreachedPasswordList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &BreachedPasswordList{file: file, size: info.Size()}, nil
+}
+
+// Range returns the hash suffixes, with their counts, of every entry whose
+// SHA-1 starts with prefix.
+func (l *BreachedPasswordList) Range(prefix string) (map[string]int64, error) {
+	prefix = strings.ToUpper(prefix)
+	// binary search for the first line that does not sort before prefix
+	lo, hi := int64(0), l.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		_, line, err := l.lineFrom(mid)
+		if err != nil {
+			return nil, err
+		}
+		if line != "" && strings.ToUpper(line) < prefix {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	start, _, err := l.lineFrom(lo)
+	if err != nil {
+		return nil, err
+	}
+	suffixes := map[string]int64{}
+	scanner := bufio.NewScanner(io.NewSectionReader(l.file, start, l.size-start))
+	for scanner.Scan() {
+		line := strings.ToUpper(strings.TrimSpace(scanner.Text()))
+		if !strings.HasPrefix(line, prefix) {
+			break
+		}
+		hash, countText, _ := strings.Cut(line, ":")
+		count, err := strconv.ParseInt(countText, 10, 64)
+		if err != nil {
+			count = 1
+		}
+		suffixes[hash[len(prefix):]] = count
+	}
+	return suffixes, scanner.Err()
+}
+
+// lineFrom returns the first line starting at or after offset, with its
+// start. The line is empty at the end of the file.
+func (l *BreachedPasswordList) lineFrom(offset int64) (int64, string, error) {
+	start := offset
+	if offset > 0 {
+		// unless offset is itself a line start, skip to the next one
+		reader := bufio.NewReader(io.NewSectionReader(l.file, offset-1, l.size-offset+1))
+		skipped, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return l.size, "", nil
+		}
+		if err != nil {
+			return 0, "", err
+		}
+		start = offset - 1 + int64(len(skipped))
+	}
+	reader := bufio.NewReader(io.NewSectionReader(l.file, start, l.size-start))
+	line, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, "", err
+	}
+	return start, strings.TrimSpace(line), nil
+}
+
+// Count reports how often password appears in the list.
+func (l *BreachedPasswordList) Count(password string) (int64, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	suffixes, err := l.Range(hash[:5])
+	if err != nil {
+		return 0, err
+	}
+	return suffixes[hash[5:]], nil
+}
@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"maps"
+	"os"
+	"strings"
+	"testing"
+)
+
+// the fixture is sorted like the real list; its last line has no newline
+const breachedPasswordsFixture = "testdata/breached_passwords.txt"
+
+func openBreachedPasswordsFixture(t *testing.T) *BreachedPasswordList {
+	t.Helper()
+	list, err := OpenBreachedPasswordList(breachedPasswordsFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { list.file.Close() })
+	return list
+}
+
+func TestBreachedPasswordRange(t *testing.T) {
+	list := openBreachedPasswordsFixture(t)
+	tests := []struct {
+		name   string
+		prefix string
+		want   map[string]int64
+	}{
+		{"prefix of the first lines", "00000", map[string]int64{
+			"00000000000000000000000000000000001": 3,
+			"00000000000000000000000000000000002": 5,
+		}},
+		{"prefix in the middle", "5BAA6", map[string]int64{
+			"00000000000000000000000000000000000": 2,
+			"1E4C9B93F3F0682250B6CF8331B7EE68FD8": 9545824,
+		}},
+		{"lowercase prefix", "5baa6", map[string]int64{
+			"00000000000000000000000000000000000": 2,
+			"1E4C9B93F3F0682250B6CF8331B7EE68FD8": 9545824,
+		}},
+		{"line without a count", "7C4A8", map[string]int64{"D09CA3762AF61E59520943DC26494F8941B": 1}},
+		{"prefix at the end of the file", "FFFFF", map[string]int64{"0000000000000000000000000000000000A": 7}},
+		{"prefix between two lines", "ABCDE", map[string]int64{}},
+		{"prefix sorting before every line", "0000", map[string]int64{
+			"000000000000000000000000000000000001": 3,
+			"000000000000000000000000000000000002": 5,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := list.Range(tt.prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Fatalf("Range(%q) = %v, want %v", tt.prefix, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreachedPasswordLineFrom(t *testing.T) {
+	list := openBreachedPasswordsFixture(t)
+	content, err := os.ReadFile(breachedPasswordsFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(content), "\n")
+	// starts[i] is the offset of lines[i]
+	starts := make([]int64, len(lines))
+	for i := 1; i < len(lines); i++ {
+		starts[i] = starts[i-1] + int64(len(lines[i-1])) + 1
+	}
+	last := len(lines) - 1
+	size := int64(len(content))
+	tests := []struct {
+		name      string
+		offset    int64
+		wantStart int64
+		wantLine  string
+	}{
+		{"start of the file", 0, 0, lines[0]},
+		{"inside the first line", 1, starts[1], lines[1]},
+		{"on a newline", starts[2] - 1, starts[2], lines[2]},
+		{"at a line start", starts[2], starts[2], lines[2]},
+		{"at the last line", starts[last], starts[last], lines[last]},
+		{"inside the last line", starts[last] + 1, size, ""},
+		{"end of the file", size, size, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, line, err := list.lineFrom(tt.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if start != tt.wantStart || line != tt.wantLine {
+				t.Fatalf("lineFrom(%d) = %d, %q, want %d, %q", tt.offset, start, line, tt.wantStart, tt.wantLine)
+			}
+		})
+	}
+}
+
+func TestBreachedPasswordCount(t *testing.T) {
+	list := openBreachedPasswordsFixture(t)
+	for password, want := range map[string]int64{"password": 9545824, "123456": 1, "not in the list": 0} {
+		got, err := list.Count(password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Count(%q) = %d, want %d", password, got, want)
+		}
+	}
+}
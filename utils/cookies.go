@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ardiannm/go/config"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	CSRFCookie         = "csrf_token"
+	CSRFHeader         = "X-CSRF-Token"
+	OIDCStateCookie    = "oidc_state"
+	// the refresh cookie is only ever sent to the refresh endpoint
+	refreshCookiePath = "/users/refresh"
+)
+
+func cookieSameSite() http.SameSite {
+	switch strings.ToLower(config.Env.COOKIE_SAMESITE) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+func setCookie(ctx *gin.Context, name, value, path string, maxAge int, httpOnly bool) {
+	http.SetCookie(ctx.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   config.Env.COOKIE_DOMAIN,
+		MaxAge:   maxAge,
+		Secure:   config.Env.COOKIE_SECURE,
+		HttpOnly: httpOnly,
+		SameSite: cookieSameSite(),
+	})
+}
+
+// SetAuthCookies stores the token pair in HttpOnly cookies and issues a new
+// CSRF token, readable by scripts, which is returned as well.
+func SetAuthCookies(ctx *gin.Context, token, refreshToken string) (string, error) {
+	csrfToken, _, err := GenerateSecureToken()
+	if err != nil {
+		return "", err
+	}
+	setCookie(ctx, AccessTokenCookie, token, "/", int(AccessTokenLifetime.Seconds()), true)
+	setCookie(ctx, RefreshTokenCookie, refreshToken, refreshCookiePath, int(RefreshTokenLifetime.Seconds()), true)
+	setCookie(ctx, CSRFCookie, csrfToken, "/", int(RefreshTokenLifetime.Seconds()), false)
+	return csrfToken, nil
+}
+
+func ClearAuthCookies(ctx *gin.Context) {
+	setCookie(ctx, AccessTokenCookie, "", "/", -1, true)
+	setCookie(ctx, RefreshTokenCookie, "", refreshCookiePath, -1, true)
+	setCookie(ctx, CSRFCookie, "", "/", -1, false)
+}
+
+// GetCookieToken returns the named token cookie when cookie mode is on.
+func GetCookieToken(ctx *gin.Context, name string) string {
+	if !config.Env.AUTH_COOKIES_ENABLED {
+		return ""
+	}
+	value, err := ctx.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
+// ValidCSRF implements the double-submit check: the header must echo the
+// CSRF cookie, which a cross-site page can neither read nor set.
+func ValidCSRF(ctx *gin.Context) bool {
+	cookie, err := ctx.Cookie(CSRFCookie)
+	if err != nil || cookie == "" {
+		return false
+	}
+	header := ctx.GetHeader(CSRFHeader)
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
+
+// SetOIDCStateCookie ties a pending social login to the browser that started
+// it. The cookie holds a hash of the state and must be Lax: the provider
+// redirects back with a cross-site top-level navigation.
+func SetOIDCStateCookie(ctx *gin.Context, state string, lifetime time.Duration) {
+	setOIDCStateCookie(ctx, HashSecureToken(state), int(lifetime.Seconds()))
+}
+
+func setOIDCStateCookie(ctx *gin.Context, value string, maxAge int) {
+	http.SetCookie(ctx.Writer, &http.Cookie{
+		Name:     OIDCStateCookie,
+		Value:    value,
+		Path:     "/auth/oidc",
+		Domain:   config.Env.COOKIE_DOMAIN,
+		MaxAge:   maxAge,
+		Secure:   config.Env.COOKIE_SECURE,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ConsumeOIDCStateCookie clears the state cookie and reports whether it was
+// set for state, so a callback forged by another site is refused before the
+// pending login is looked up.
+func ConsumeOIDCStateCookie(ctx *gin.Context, state string) bool {
+	cookie, err := ctx.Cookie(OIDCStateCookie)
+	if err != nil || cookie == "" {
+		return false
+	}
+	setOIDCStateCookie(ctx, "", -1)
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(HashSecureToken(state))) == 1
+}
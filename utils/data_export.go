@@ -0,0 +1,279 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/ardiannm/go/config"
+	"github.com/ardiannm/go/database"
+	"github.com/ardiannm/go/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ExportFileName is the JSON document inside every export archive.
+const ExportFileName = "export.json"
+
+// a running export not finished within this time is assumed abandoned and
+// picked up again
+const exportClaimTimeout = 10 * time.Minute
+
+const exportReadme = `This archive contains the personal data Gotrock holds about your account.
+
+export.json has one section per kind of record:
+  profile         your account details and favourite genres
+  identities      accounts at other providers linked for sign-in
+  sessions        devices currently signed in
+  api_keys        API keys you created (the keys themselves are never stored)
+  login_attempts  recent failed sign-in attempts against your email
+  audit_events    security events you performed or that concern you
+  invitations     the invitation you signed up with, if any
+  data_exports    earlier export requests
+
+Movie reviews are written by Gotrock staff and are not linked to accounts,
+so they are not included. Recommendations are derived from your favourite
+genres, which are part of your profile. Password hashes and two-factor
+secrets are withheld because they are security material, not personal data.
+`
+
+// userDataDocument is the layout of export.json
+type userDataDocument struct {
+	GeneratedAt   time.Time                 `json:"generated_at"`
+	UserID        string                    `json:"user_id"`
+	Profile       models.UserProfile        `json:"profile"`
+	Identities    []models.ExternalIdentity `json:"identities"`
+	Sessions      []models.Session          `json:"sessions"`
+	APIKeys       []models.APIKey           `json:"api_keys"`
+	LoginAttempts []models.LoginAttempt     `json:"login_attempts"`
+	AuditEvents   []models.AuditEvent       `json:"audit_events"`
+	Invitations   []invitationRedemption    `json:"invitations"`
+	DataExports   []models.DataExport       `json:"data_exports"`
+}
+
+// invitationRedemption is the user's redemption of an invitation
+type invitationRedemption struct {
+	InvitationID string `json:"invitation_id"`
+	models.InvitationRedemption
+}
+
+var ErrExportInProgress = errors.New("An export for this user is already in progress")
+
+var dataExportCollection *mongo.Collection = database.OpenCollection("data_exports")
+
+// CreateDataExport queues an export of the user's data for the export worker.
+func CreateDataExport(userId, requestedBy string) (models.DataExport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	active := bson.M{"user_id": userId, "status": bson.M{"$in": bson.A{models.ExportPending, models.ExportRunning}}}
+	count, err := dataExportCollection.CountDocuments(ctx, active, options.Count().SetLimit(1))
+	if err != nil {
+		return models.DataExport{}, err
+	}
+	if count > 0 {
+		return models.DataExport{}, ErrExportInProgress
+	}
+	export := models.DataExport{
+		ExportID:    bson.NewObjectID().Hex(),
+		UserID:      userId,
+		RequestedBy: requestedBy,
+		Status:      models.ExportPending,
+		CreatedAt:   time.Now(),
+		ExpiresAt:   time.Now().Add(time.Duration(config.Env.DATA_EXPORT_TTL_HOURS) * time.Hour),
+	}
+	_, err = dataExportCollection.InsertOne(ctx, export)
+	return export, err
+}
+
+// FindDataExport loads an export, leaving out the archive unless asked for.
+func FindDataExport(exportID string, withArchive bool) (models.DataExport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	findOptions := options.FindOne()
+	if !withArchive {
+		findOptions.SetProjection(bson.M{"archive": 0})
+	}
+	var export models.DataExport
+	err := dataExportCollection.FindOne(ctx, bson.M{"export_id": exportID}, findOptions).Decode(&export)
+	return export, err
+}
+
+// BuildUserDataArchive collects everything stored about a user into a ZIP
+// file holding export.json and a README.
+func BuildUserDataArchive(userId string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+		return nil, err
+	}
+	identities := user.Identities
+	if identities == nil {
+		identities = []models.ExternalIdentity{}
+	}
+	sessions := []models.Session{}
+	apiKeys := []models.APIKey{}
+	attempts := []models.LoginAttempt{}
+	events := []models.AuditEvent{}
+	exports := []models.DataExport{}
+	sections := []struct {
+		collection *mongo.Collection
+		filter     bson.M
+		into       any
+	}{
+		{sessionCollection, bson.M{"user_id": userId}, &sessions},
+		{apiKeyCollection, bson.M{"user_id": userId}, &apiKeys},
+		{loginAttemptCollection, bson.M{"key": AccountThrottleKey(user.Email)}, &attempts},
+		{auditCollection, bson.M{"$or": bson.A{bson.M{"actor_id": userId}, bson.M{"target_id": userId}}}, &events},
+		{dataExportCollection, bson.M{"user_id": userId}, &exports},
+	}
+	for _, section := range sections {
+		findOptions := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+		if section.collection == dataExportCollection {
+			findOptions.SetProjection(bson.M{"archive": 0})
+		}
+		cursor, err := section.collection.Find(ctx, section.filter, findOptions)
+		if err != nil {
+			return nil, err
+		}
+		if err := cursor.All(ctx, section.into); err != nil {
+			return nil, err
+		}
+	}
+	redemptions, err := findInvitationRedemptions(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	document, err := json.MarshalIndent(userDataDocument{
+		GeneratedAt:   time.Now(),
+		UserID:        userId,
+		Profile:       user.Profile(),
+		Identities:    identities,
+		Sessions:      sessions,
+		APIKeys:       apiKeys,
+		LoginAttempts: attempts,
+		AuditEvents:   events,
+		Invitations:   redemptions,
+		DataExports:   exports,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	files := []struct {
+		name    string
+		content []byte
+	}{
+		{ExportFileName, document},
+		{"README.txt", []byte(exportReadme)},
+	}
+	for _, file := range files {
+		w, err := writer.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(file.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return archive.Bytes(), nil
+}
+
+// findInvitationRedemptions returns the user's redemptions without those of
+// anyone else who used the same invitation.
+func findInvitationRedemptions(ctx context.Context, userId string) ([]invitationRedemption, error) {
+	findOptions := options.Find().
+		SetProjection(bson.M{"invitation_id": 1, "redemptions": bson.M{"$elemMatch": bson.M{"user_id": userId}}}).
+		SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := invitationCollection.Find(ctx, bson.M{"redemptions.user_id": userId}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	var invitations []models.Invitation
+	if err := cursor.All(ctx, &invitations); err != nil {
+		return nil, err
+	}
+	redemptions := []invitationRedemption{}
+	for _, invitation := range invitations {
+		for _, redemption := range invitation.Redemptions {
+			redemptions = append(redemptions, invitationRedemption{invitation.InvitationID, redemption})
+		}
+	}
+	return redemptions, nil
+}
+
+// claimDataExport marks the oldest waiting export as running and returns it,
+// so several server instances never build the same export.
+func claimDataExport() (*models.DataExport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	filter := bson.M{"$or": bson.A{
+		bson.M{"status": models.ExportPending},
+		bson.M{"status": models.ExportRunning, "started_at": bson.M{"$lt": time.Now().Add(-exportClaimTimeout)}},
+	}}
+	update := bson.M{"$set": bson.M{"status": models.ExportRunning, "started_at": time.Now()}}
+	findOptions := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetProjection(bson.M{"archive": 0}).
+		SetReturnDocument(options.After)
+	var export models.DataExport
+	err := dataExportCollection.FindOneAndUpdate(ctx, filter, update, findOptions).Decode(&export)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func processDataExport(export *models.DataExport) error {
+	archive, buildErr := BuildUserDataArchive(export.UserID)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	set := bson.M{"completed_at": time.Now()}
+	if buildErr != nil {
+		set["status"] = models.ExportFailed
+		set["error"] = buildErr.Error()
+	} else {
+		sum := sha256.Sum256(archive)
+		set["status"] = models.ExportReady
+		set["archive"] = archive
+		set["size"] = len(archive)
+		set["sha256"] = hex.EncodeToString(sum[:])
+	}
+	_, err := dataExportCollection.UpdateOne(ctx, bson.M{"export_id": export.ExportID}, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	return buildErr
+}
+
+// RunDataExportWorker builds queued exports, checking for new ones every
+// interval, forever.
+func RunDataExportWorker(interval time.Duration) {
+	for {
+		export, err := claimDataExport()
+		if err != nil {
+			log.Println("Failed to claim data export:", err)
+		}
+		if export == nil {
+			time.Sleep(interval)
+			continue
+		}
+		if err := processDataExport(export); err != nil {
+			log.Println("Failed to build data export", export.ExportID+":", err)
+		}
+	}
+}
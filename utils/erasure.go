@@ -0,0 +1,203 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ardiannm/go/database"
+	"github.com/ardiannm/go/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// stands in for a user's id in audit events that outlive them
+const erasedUser = "erased"
+
+var erasureCollection *mongo.Collection = database.OpenCollection("erasure_records")
+
+// EraseUser deletes a user and everything tied to them, anonymises the audit
+// events that mention them and stores an ErasureRecord. requestedBy is an
+// admin's user_id, "self" or "system". It returns nil when there is no such
+// user. Every step can be repeated, so a failed erasure is retried by calling
+// it again.
+func EraseUser(userId, requestedBy, reason string) (*models.ErasureRecord, error) {
+	return eraseUser(bson.M{"user_id": userId}, userId, requestedBy, reason)
+}
+
+func eraseUser(filter bson.M, userId, requestedBy, reason string) (*models.ErasureRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	record := models.ErasureRecord{
+		ErasureID:   bson.NewObjectID().Hex(),
+		SubjectHash: HashSecureToken(userId),
+		RequestedBy: requestedBy,
+		Reason:      reason,
+		StartedAt:   time.Now(),
+	}
+	var user models.User
+	err := userCollection.FindOne(ctx, filter).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	accountKey := AccountThrottleKey(user.Email)
+	deletions := []struct {
+		collection *mongo.Collection
+		filter     bson.M
+	}{
+		// their own sessions and those in which they impersonated someone
+		{sessionCollection, userSessionsFilter(userId)},
+		// nobody else can redeem an invitation bound to their address
+		{invitationCollection, boundInvitationsFilter(user.Email)},
+		{apiKeyCollection, bson.M{"user_id": userId}},
+		{dataExportCollection, bson.M{"user_id": userId}},
+		{revokedTokenCollection, bson.M{"user_id": userId}},
+		{loginAttemptCollection, bson.M{"key": accountKey}},
+	}
+	for _, deletion := range deletions {
+		result, err := deletion.collection.DeleteMany(ctx, deletion.filter)
+		if err != nil {
+			return nil, err
+		}
+		record.Steps = append(record.Steps, models.ErasureStep{Collection: deletion.collection.Name(), Action: "deleted", Count: result.DeletedCount})
+	}
+	// audit events are kept for the security history but lose everything
+	// that points back at the person
+	anonymisations := []struct {
+		filter bson.M
+		set    bson.M
+	}{
+		{bson.M{"actor_id": userId}, bson.M{"actor_id": erasedUser}},
+		{bson.M{"target_id": userId}, bson.M{"target_id": erasedUser}},
+		{bson.M{"details.key": accountKey}, bson.M{}},
+	}
+	var anonymised int64
+	for _, anonymisation := range anonymisations {
+		update := bson.M{"$unset": bson.M{"ip": "", "details": ""}}
+		if len(anonymisation.set) > 0 {
+			update["$set"] = anonymisation.set
+		}
+		result, err := auditCollection.UpdateMany(ctx, anonymisation.filter, update)
+		if err != nil {
+			return nil, err
+		}
+		anonymised += result.ModifiedCount
+	}
+	record.Steps = append(record.Steps, models.ErasureStep{Collection: auditCollection.Name(), Action: "anonymised", Count: anonymised})
+
+	// invitation usage counts stay right, only who redeemed them is lost
+	redeemed, err := invitationCollection.UpdateMany(ctx,
+		bson.M{"redemptions.user_id": userId},
+		bson.M{"$set": bson.M{
+			"redemptions.$[r].user_id": erasedUser,
+			"redemptions.$[r].email":   "",
+			"redemptions.$[r].ip":      "",
+		}},
+		options.UpdateMany().SetArrayFilters([]any{bson.M{"r.user_id": userId}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	// invitations they sent stay valid for whoever they were meant for
+	created, err := invitationCollection.UpdateMany(ctx,
+		bson.M{"created_by": userId},
+		bson.M{"$set": bson.M{"created_by": erasedUser}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	record.Steps = append(record.Steps, models.ErasureStep{Collection: invitationCollection.Name(), Action: "anonymised", Count: redeemed.ModifiedCount + created.ModifiedCount})
+
+	// the user goes last, so an erasure that failed part way still finds
+	// them and can simply be run again
+	deleted, err := userCollection.DeleteOne(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if deleted.DeletedCount == 0 {
+		// restored or erased by someone else in the meantime
+		return nil, nil
+	}
+	record.Steps = append(record.Steps, models.ErasureStep{Collection: userCollection.Name(), Action: "deleted", Count: deleted.DeletedCount})
+
+	remaining, err := countUserReferences(ctx, userId, user.Email)
+	if err != nil {
+		return nil, err
+	}
+	record.Remaining = remaining
+	record.Verified = true
+	for _, count := range remaining {
+		if count > 0 {
+			record.Verified = false
+		}
+	}
+	record.CompletedAt = time.Now()
+	if _, err := erasureCollection.InsertOne(ctx, record); err != nil {
+		return nil, err
+	}
+	err = RecordAuditEvent(models.AuditEvent{
+		Type:    "account.erase",
+		Details: bson.M{"erasure_id": record.ErasureID, "subject_hash": record.SubjectHash, "verified": record.Verified},
+	})
+	if err != nil {
+		log.Println("Failed to record erasure:", err)
+	}
+	return &record, nil
+}
+
+// userSessionsFilter matches the sessions of the user and the sessions they
+// opened as someone else.
+func userSessionsFilter(userId string) bson.M {
+	return bson.M{"$or": bson.A{bson.M{"user_id": userId}, bson.M{"impersonator_id": userId}}}
+}
+
+// boundInvitationsFilter matches the invitations only email may redeem;
+// never the open ones, which have no email.
+func boundInvitationsFilter(email string) bson.M {
+	return bson.M{"email": bson.M{"$eq": strings.ToLower(email), "$ne": ""}}
+}
+
+// countUserReferences counts, per collection, the documents that still refer
+// to the user.
+func countUserReferences(ctx context.Context, userId, email string) (map[string]int64, error) {
+	accountKey := AccountThrottleKey(email)
+	checks := []struct {
+		collection *mongo.Collection
+		filter     bson.M
+	}{
+		{userCollection, bson.M{"user_id": userId}},
+		{sessionCollection, userSessionsFilter(userId)},
+		{apiKeyCollection, bson.M{"user_id": userId}},
+		{dataExportCollection, bson.M{"user_id": userId}},
+		{revokedTokenCollection, bson.M{"user_id": userId}},
+		{loginAttemptCollection, bson.M{"key": accountKey}},
+		{invitationCollection, bson.M{"$or": bson.A{
+			bson.M{"redemptions.user_id": userId},
+			bson.M{"created_by": userId},
+			boundInvitationsFilter(email),
+		}}},
+		{auditCollection, bson.M{"$or": bson.A{bson.M{"actor_id": userId}, bson.M{"target_id": userId}, bson.M{"details.key": accountKey}}}},
+	}
+	remaining := map[string]int64{}
+	for _, check := range checks {
+		count, err := check.collection.CountDocuments(ctx, check.filter)
+		if err != nil {
+			return nil, err
+		}
+		remaining[check.collection.Name()] = count
+	}
+	return remaining, nil
+}
+
+func FindErasureRecord(erasureID string) (models.ErasureRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var record models.ErasureRecord
+	err := erasureCollection.FindOne(ctx, bson.M{"erasure_id": erasureID}).Decode(&record)
+	return record, err
+}
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// CollectionIndexes declares the indexes one collection needs.
+type CollectionIndexes struct {
+	Collection *mongo.Collection
+	Indexes    []mongo.IndexModel
+}
+
+func indexKeys(field string, order int) bson.D {
+	return bson.D{{Key: field, Value: order}}
+}
+
+func uniqueIndex() *options.IndexOptionsBuilder {
+	return options.Index().SetUnique(true)
+}
+
+// ttlIndex makes MongoDB delete documents once their date field has passed.
+func ttlIndex() *options.IndexOptionsBuilder {
+	return options.Index().SetExpireAfterSeconds(0)
+}
+
+// IndexRegistry lists every index the API relies on, per collection. Indexes
+// are only ever created, so one removed from here stays in the database
+// until it is dropped by hand.
+func IndexRegistry() []CollectionIndexes {
+	movieIndexes := []mongo.IndexModel{
+		// GetMovie and every edit look movies up by imdb_id
+		{Keys: indexKeys("imdb_id", 1), Options: uniqueIndex()},
+		// GetRecommendedMovies filters on genre and sorts by ranking
+		{Keys: bson.D{{Key: "genre.genre_name", Value: 1}, {Key: "ranking.ranking_value", Value: 1}}},
+		// keyset pagination in GetMovies sorts by one of these and then _id
+		{Keys: bson.D{{Key: "title", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "ranking.ranking_value", Value: 1}, {Key: "_id", Value: 1}}},
+	}
+	if movieSearcher.Name() == "mongo" {
+		// a collection can only have one text index
+		movieIndexes = append(movieIndexes, mongo.IndexModel{
+			Keys: bson.D{{Key: "title", Value: "text"}, {Key: "admin_review", Value: "text"}},
+			Options: options.Index().
+				SetName("movie_text").
+				SetWeights(bson.D{{Key: "title", Value: 3}, {Key: "admin_review", Value: 1}}),
+		})
+	}
+	return []CollectionIndexes{
+		{movieCollection, movieIndexes},
+		{userCollection, []mongo.IndexModel{
+			// closes the race between RegisterUser's existence check and insert
+			{Keys: indexKeys("email", 1), Options: uniqueIndex()},
+			{Keys: indexKeys("user_id", 1), Options: uniqueIndex()},
+			{Keys: bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		}},
+		{roleCollection, []mongo.IndexModel{
+			{Keys: indexKeys("name", 1), Options: uniqueIndex()},
+		}},
+		{sessionCollection, []mongo.IndexModel{
+			{Keys: indexKeys("session_id", 1), Options: uniqueIndex()},
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "last_seen_at", Value: -1}}},
+			{Keys: indexKeys("expires_at", 1), Options: ttlIndex()},
+		}},
+		{revokedTokenCollection, []mongo.IndexModel{
+			{Keys: indexKeys("expires_at", 1), Options: ttlIndex()},
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "revoked_before", Value: 1}}},
+		}},
+		{loginAttemptCollection, []mongo.IndexModel{
+			{Keys: indexKeys("key", 1), Options: uniqueIndex()},
+			{Keys: indexKeys("expires_at", 1), Options: ttlIndex()},
+		}},
+		{apiKeyCollection, []mongo.IndexModel{
+			{Keys: indexKeys("prefix", 1), Options: uniqueIndex()},
+			{Keys: indexKeys("key_id", 1), Options: uniqueIndex()},
+			{Keys: indexKeys("user_id", 1)},
+		}},
+		{oidcStateCollection, []mongo.IndexModel{
+			{Keys: indexKeys("state", 1), Options: uniqueIndex()},
+			{Keys: indexKeys("expires_at", 1), Options: ttlIndex()},
+		}},
+		{dataExportCollection, []mongo.IndexModel{
+			{Keys: indexKeys("export_id", 1), Options: uniqueIndex()},
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "status", Value: 1}}},
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}}},
+			{Keys: indexKeys("expires_at", 1), Options: ttlIndex()},
+		}},
+		{erasureCollection, []mongo.IndexModel{
+			{Keys: indexKeys("erasure_id", 1), Options: uniqueIndex()},
+		}},
+		{invitationCollection, []mongo.IndexModel{
+			{Keys: indexKeys("code_hash", 1), Options: uniqueIndex()},
+			{Keys: indexKeys("invitation_id", 1), Options: uniqueIndex()},
+			{Keys: indexKeys("created_at", -1)},
+		}},
+		{auditCollection, []mongo.IndexModel{
+			// account erasure looks events up by the people involved
+			{Keys: indexKeys("actor_id", 1)},
+			{Keys: indexKeys("target_id", 1)},
+		}},
+	}
+}
+
+// EnsureIndexes creates the indexes of the registry that are missing and
+// returns the index names per collection. Creating an index that already
+// exists is a no-op; one whose options changed, or a unique index over
+// duplicate values, fails with an error naming the collection.
+func EnsureIndexes() (map[string][]string, error) {
+	ensured := map[string][]string{}
+	for _, spec := range IndexRegistry() {
+		// building an index on a large collection can take a while
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		names, err := spec.Collection.Indexes().CreateMany(ctx, spec.Indexes)
+		cancel()
+		if err != nil {
+			return ensured, fmt.Errorf("%s: %w", spec.Collection.Name(), err)
+		}
+		ensured[spec.Collection.Name()] = names
+	}
+	return ensured, nil
+}
+
+// IsDuplicateKey reports whether err was caused by a unique index.
+func IsDuplicateKey(err error) bool {
+	return mongo.IsDuplicateKeyError(err)
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ardiannm/go/database"
+	"github.com/ardiannm/go/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var ErrInvitationInvalid = errors.New("Invitation code is invalid, expired, used up or meant for another email")
+
+var invitationCollection *mongo.Collection = database.OpenCollection("invitations")
+
+// RedeemInvitation claims one use of the invitation for a new account. The
+// checks and the claim happen in one update, so a code can never admit more
+// accounts than it allows.
+func RedeemInvitation(code string, redemption models.InvitationRedemption) (models.Invitation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	filter := bson.M{
+		"code_hash":  HashSecureToken(code),
+		"revoked_at": bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": time.Now()},
+		"email":      bson.M{"$in": bson.A{"", strings.ToLower(redemption.Email)}},
+		"$expr":      bson.M{"$lt": bson.A{"$uses", "$max_uses"}},
+	}
+	update := bson.M{
+		"$inc":  bson.M{"uses": 1},
+		"$push": bson.M{"redemptions": redemption},
+	}
+	var invitation models.Invitation
+	err := invitationCollection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&invitation)
+	if err == mongo.ErrNoDocuments {
+		return invitation, ErrInvitationInvalid
+	}
+	return invitation, err
+}
+
+// ReleaseInvitation gives back a use claimed for an account that was not
+// created after all.
+func ReleaseInvitation(invitationID, userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	update := bson.M{
+		"$inc":  bson.M{"uses": -1},
+		"$pull": bson.M{"redemptions": bson.M{"user_id": userId}},
+	}
+	_, err := invitationCollection.UpdateOne(ctx, bson.M{"invitation_id": invitationID, "redemptions.user_id": userId}, update)
+	return err
+}
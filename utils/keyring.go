@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+
+	"github.com/ardiannm/go/config"
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	KeyStatusActive   = "active"
+	KeyStatusRetiring = "retiring"
+)
+
+// KeyringFile is the on-disk layout of JWT_KEYRING_FILE. Tokens are signed
+// with the first active key holding a private key; every listed key is
+// accepted for verification and published in the JWKS.
+type KeyringFile struct {
+	Keys []struct {
+		KID            string `json:"kid"`
+		Alg            string `json:"alg"`
+		Status         string `json:"status"`
+		PrivateKeyFile string `json:"private_key_file"`
+		PublicKeyFile  string `json:"public_key_file"`
+	} `json:"keys"`
+}
+
+type signingKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	Status     string
+	PrivateKey crypto.PrivateKey
+	PublicKey  crypto.PublicKey
+	// HMAC keys are never published
+	Shared bool
+}
+
+type Keyring struct {
+	keys    map[string]*signingKey
+	order   []string
+	signing *signingKey
+}
+
+var keyring *Keyring = mustLoadKeyring()
+
+func mustLoadKeyring() *Keyring {
+	if config.Env.JWT_KEYRING_FILE == "" {
+		secret := []byte(config.Env.SECRET_ACCESS_KEY)
+		key := &signingKey{ID: "hs256", Method: jwt.SigningMethodHS256, Status: KeyStatusActive, PrivateKey: secret, PublicKey: secret, Shared: true}
+		return &Keyring{keys: map[string]*signingKey{key.ID: key}, order: []string{key.ID}, signing: key}
+	}
+	ring, err := LoadKeyring(config.Env.JWT_KEYRING_FILE)
+	if err != nil {
+		log.Fatalf("❌ Failed to load JWT keyring: %v", err)
+	}
+	return ring
+}
+
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file KeyringFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	ring := &Keyring{keys: map[string]*signingKey{}}
+	for _, entry := range file.Keys {
+		if entry.KID == "" {
+			return nil, errors.New("every key needs a kid")
+		}
+		if _, exists := ring.keys[entry.KID]; exists {
+			return nil, fmt.Errorf("duplicate kid %q", entry.KID)
+		}
+		if entry.Status != KeyStatusActive && entry.Status != KeyStatusRetiring {
+			return nil, fmt.Errorf("key %q has unknown status %q", entry.KID, entry.Status)
+		}
+		key := &signingKey{ID: entry.KID, Status: entry.Status}
+		switch entry.Alg {
+		case "RS256":
+			key.Method = jwt.SigningMethodRS256
+		case "EdDSA":
+			key.Method = jwt.SigningMethodEdDSA
+		default:
+			return nil, fmt.Errorf("key %q has unsupported alg %q", entry.KID, entry.Alg)
+		}
+		if entry.PrivateKeyFile != "" {
+			pem, err := os.ReadFile(entry.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			if entry.Alg == "RS256" {
+				private, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+				if err != nil {
+					return nil, fmt.Errorf("key %q: %w", entry.KID, err)
+				}
+				key.PrivateKey, key.PublicKey = private, &private.PublicKey
+			} else {
+				private, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+				if err != nil {
+					return nil, fmt.Errorf("key %q: %w", entry.KID, err)
+				}
+				key.PrivateKey, key.PublicKey = private, private.(ed25519.PrivateKey).Public()
+			}
+		} else if entry.PublicKeyFile != "" {
+			pem, err := os.ReadFile(entry.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			if entry.Alg == "RS256" {
+				key.PublicKey, err = jwt.ParseRSAPublicKeyFromPEM(pem)
+			} else {
+				key.PublicKey, err = jwt.ParseEdPublicKeyFromPEM(pem)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", entry.KID, err)
+			}
+		} else {
+			return nil, fmt.Errorf("key %q needs a private_key_file or public_key_file", entry.KID)
+		}
+		if ring.signing == nil && key.Status == KeyStatusActive && key.PrivateKey != nil {
+			ring.signing = key
+		}
+		ring.keys[key.ID] = key
+		ring.order = append(ring.order, key.ID)
+	}
+	if ring.signing == nil {
+		return nil, errors.New("keyring has no active key with a private key")
+	}
+	return ring, nil
+}
+
+func (ring *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ring.signing.Method, claims)
+	token.Header["kid"] = ring.signing.ID
+	return token.SignedString(ring.signing.PrivateKey)
+}
+
+// Keyfunc picks the verification key by the token's kid header.
+func (ring *Keyring) Keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" && ring.signing.Shared {
+		// tokens minted before key IDs were introduced
+		kid = ring.signing.ID
+	}
+	key, ok := ring.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, errors.New("Unexpected signing method")
+	}
+	return key.PublicKey, nil
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (ring *Keyring) PublicJWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, kid := range ring.order {
+		key := ring.keys[kid]
+		if key.Shared {
+			continue
+		}
+		switch public := key.PublicKey.(type) {
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				Kty: "RSA",
+				Kid: key.ID,
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				Kty: "OKP",
+				Kid: key.ID,
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+	return jwks
+}
+
+func GetPublicJWKS() JWKS {
+	return keyring.PublicJWKS()
+}
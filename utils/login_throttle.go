@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/ardiannm/go/config"
+	"github.com/ardiannm/go/database"
+	"github.com/ardiannm/go/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var loginAttemptCollection *mongo.Collection = database.OpenCollection("login_attempts")
+
+func AccountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func IPThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// LoginRetryAfter reports how long the longest running lockout among keys
+// still lasts, or zero when none of them is locked.
+func LoginRetryAfter(keys ...string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	now := time.Now()
+	filter := bson.M{"key": bson.M{"$in": keys}, "locked_until": bson.M{"$gt": now}}
+	findOptions := options.FindOne().SetSort(bson.D{{Key: "locked_until", Value: -1}})
+	var attempt models.LoginAttempt
+	err := loginAttemptCollection.FindOne(ctx, filter, findOptions).Decode(&attempt)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return attempt.LockedUntil.Sub(now), nil
+}
+
+// RecordLoginFailure counts a failure against key and returns the lockout it
+// triggered, which is zero while the key is still under its threshold.
+func RecordLoginFailure(key string, threshold int64) (time.Duration, *models.LoginAttempt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	now := time.Now()
+	window := time.Duration(config.Env.LOGIN_FAILURE_WINDOW_MINUTES) * time.Minute
+	update := bson.M{
+		"$inc": bson.M{"failures": 1},
+		"$set": bson.M{"last_failure_at": now, "expires_at": now.Add(window)},
+	}
+	updateOptions := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var attempt models.LoginAttempt
+	if err := loginAttemptCollection.FindOneAndUpdate(ctx, bson.M{"key": key}, update, updateOptions).Decode(&attempt); err != nil {
+		return 0, nil, err
+	}
+	if attempt.Failures < threshold {
+		return 0, &attempt, nil
+	}
+	lockout := lockoutDuration(attempt.Failures - threshold)
+	attempt.LockedUntil = now.Add(lockout)
+	// keep the record around at least as long as the lockout
+	expiresAt := attempt.LockedUntil
+	if attempt.ExpiresAt.After(expiresAt) {
+		expiresAt = attempt.ExpiresAt
+	}
+	_, err := loginAttemptCollection.UpdateOne(ctx, bson.M{"key": key}, bson.M{
+		"$set": bson.M{"locked_until": attempt.LockedUntil, "expires_at": expiresAt},
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return lockout, &attempt, nil
+}
+
+func lockoutDuration(excess int64) time.Duration {
+	base := float64(config.Env.LOGIN_LOCKOUT_BASE_SECONDS)
+	max := float64(config.Env.LOGIN_LOCKOUT_MAX_SECONDS)
+	seconds := math.Min(base*math.Pow(2, float64(excess)), max)
+	return time.Duration(seconds) * time.Second
+}
+
+func ClearLoginFailures(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := loginAttemptCollection.DeleteOne(ctx, bson.M{"key": key})
+	return err
+}
@@ -0,0 +1,364 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ardiannm/go/config"
+	"github.com/ardiannm/go/database"
+	"github.com/ardiannm/go/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var movieCollection *mongo.Collection = database.OpenCollection("movies")
+
+// movieSearchFields are the searched fields with how much a match in each
+// counts, and how many words of it a snippet shows (0 for all).
+var movieSearchFields = []struct {
+	name    string
+	weight  float64
+	window  int
+	extract func(models.Movie) string
+}{
+	{"title", 3, 0, func(m models.Movie) string { return m.Title }},
+	{"admin_review", 1, 24, func(m models.Movie) string { return m.AdminReview }},
+}
+
+// MovieSearcher is one way of searching the catalogue. Both searchers share
+// the query syntax, typo tolerance and snippets; they differ in where the
+// matching and ranking happens.
+type MovieSearcher interface {
+	Name() string
+	// Refresh rebuilds whatever the searcher keeps in memory from the
+	// catalogue.
+	Refresh(movies []models.Movie)
+	// Projection limits the movie fields Refresh is given; nil loads whole
+	// movies.
+	Projection() bson.M
+	Search(ctx context.Context, query SearchQuery, limit int) ([]models.MovieSearchResult, error)
+}
+
+func tokenizeMovie(movie models.Movie) [][]searchToken {
+	fields := make([][]searchToken, len(movieSearchFields))
+	for f, field := range movieSearchFields {
+		fields[f] = tokenize(field.extract(movie))
+	}
+	return fields
+}
+
+func movieVocabulary(movies []models.Movie) searchVocabulary {
+	words := map[string]bool{}
+	for _, movie := range movies {
+		for _, tokens := range tokenizeMovie(movie) {
+			for _, token := range tokens {
+				words[token.Word] = true
+			}
+		}
+	}
+	return newSearchVocabulary(words)
+}
+
+func movieHighlights(movie models.Movie, fields [][]searchToken, clauses []searchClause) map[string]string {
+	highlights := map[string]string{}
+	for f, field := range movieSearchFields {
+		snippet := searchSnippet(field.extract(movie), fields[f], markMatches(fields[f], clauses), field.window)
+		if snippet != "" {
+			highlights[field.name] = snippet
+		}
+	}
+	return highlights
+}
+
+// MongoTextSearcher ranks with the movies text index. Typos and prefixes are
+// handled by expanding them into catalogue words before the query is sent,
+// and hits that miss part of the query are dropped afterwards, because the
+// text index matches any single word. Hits are read in batches until enough
+// are left.
+type MongoTextSearcher struct {
+	mu         sync.RWMutex
+	vocabulary searchVocabulary
+}
+
+func (s *MongoTextSearcher) Name() string { return "mongo" }
+
+// Projection loads only the searched fields; the vocabulary is all the
+// catalogue this searcher keeps, hits are read from the collection.
+func (s *MongoTextSearcher) Projection() bson.M {
+	projection := bson.M{"_id": 0}
+	for _, field := range movieSearchFields {
+		projection[field.name] = 1
+	}
+	return projection
+}
+
+func (s *MongoTextSearcher) Refresh(movies []models.Movie) {
+	vocabulary := movieVocabulary(movies)
+	s.mu.Lock()
+	s.vocabulary = vocabulary
+	s.mu.Unlock()
+}
+
+func (s *MongoTextSearcher) Search(ctx context.Context, query SearchQuery, limit int) ([]models.MovieSearchResult, error) {
+	s.mu.RLock()
+	clauses := expandSearchQuery(query, s.vocabulary)
+	s.mu.RUnlock()
+	var search []string
+	for _, clause := range clauses {
+		if clause.phrase != nil {
+			search = append(search, `"`+strings.Join(clause.phrase, " ")+`"`)
+			continue
+		}
+		for word := range clause.variants {
+			search = append(search, word)
+		}
+	}
+	findOptions := options.Find().
+		SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		SetSort(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		SetBatchSize(int32(min(limit*5, 200)))
+	cursor, err := movieCollection.Find(ctx, bson.M{"$text": bson.M{"$search": strings.Join(search, " ")}}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	results := []models.MovieSearchResult{}
+	// further batches are only fetched while dropped hits leave the page
+	// short, so limit results come back whenever that many match
+	for len(results) < limit && cursor.Next(ctx) {
+		var hit struct {
+			models.Movie `bson:",inline"`
+			Score        float64 `bson:"score"`
+		}
+		if err := cursor.Decode(&hit); err != nil {
+			return nil, err
+		}
+		fields := tokenizeMovie(hit.Movie)
+		matched := true
+		for _, clause := range clauses {
+			if !clause.matches(fields) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		results = append(results, models.MovieSearchResult{
+			Movie:      hit.Movie,
+			Score:      hit.Score,
+			Highlights: movieHighlights(hit.Movie, fields, clauses),
+		})
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// MemoryMovieSearcher keeps an inverted index of the catalogue in process
+// and ranks with BM25, for deployments without a text index.
+type MemoryMovieSearcher struct {
+	mu         sync.RWMutex
+	movies     []models.Movie
+	fields     [][][]searchToken
+	postings   map[string][]moviePosting
+	avgLengths []float64
+	vocabulary searchVocabulary
+}
+
+// moviePosting records how often a word occurs in one field of one movie.
+type moviePosting struct {
+	movie, field, count int
+}
+
+const (
+	bm25K1      = 1.2
+	bm25B       = 0.75
+	phraseBoost = 1.5
+)
+
+func (s *MemoryMovieSearcher) Name() string { return "memory" }
+
+// Projection is nil, results are served from the movies kept in memory.
+func (s *MemoryMovieSearcher) Projection() bson.M { return nil }
+
+func (s *MemoryMovieSearcher) Refresh(movies []models.Movie) {
+	fields := make([][][]searchToken, len(movies))
+	postings := map[string][]moviePosting{}
+	avgLengths := make([]float64, len(movieSearchFields))
+	for m, movie := range movies {
+		fields[m] = tokenizeMovie(movie)
+		for f, tokens := range fields[m] {
+			avgLengths[f] += float64(len(tokens))
+			counts := map[string]int{}
+			for _, token := range tokens {
+				counts[token.Word]++
+			}
+			for word, count := range counts {
+				postings[word] = append(postings[word], moviePosting{movie: m, field: f, count: count})
+			}
+		}
+	}
+	for f := range avgLengths {
+		avgLengths[f] /= float64(max(len(movies), 1))
+	}
+	vocabulary := movieVocabulary(movies)
+	s.mu.Lock()
+	s.movies, s.fields, s.postings, s.avgLengths, s.vocabulary = movies, fields, postings, avgLengths, vocabulary
+	s.mu.Unlock()
+}
+
+// fieldScores is the weighted BM25 score of word in each field of every
+// movie containing it.
+func (s *MemoryMovieSearcher) fieldScores(word string) map[int][]float64 {
+	postings := s.postings[word]
+	documents := map[int]bool{}
+	for _, posting := range postings {
+		documents[posting.movie] = true
+	}
+	n, df := float64(len(s.movies)), float64(len(documents))
+	idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+	scores := map[int][]float64{}
+	for _, posting := range postings {
+		if scores[posting.movie] == nil {
+			scores[posting.movie] = make([]float64, len(movieSearchFields))
+		}
+		tf := float64(posting.count)
+		length := float64(len(s.fields[posting.movie][posting.field]))
+		norm := 1 - bm25B + bm25B*length/max(s.avgLengths[posting.field], 1)
+		scores[posting.movie][posting.field] = movieSearchFields[posting.field].weight * idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+	}
+	return scores
+}
+
+// clauseScores scores every movie the clause matches. A phrase only scores
+// in the fields it occurs in.
+func (s *MemoryMovieSearcher) clauseScores(clause searchClause) map[int]float64 {
+	scores := map[int]float64{}
+	if clause.phrase == nil {
+		for word, weight := range clause.variants {
+			for movie, fields := range s.fieldScores(word) {
+				var score float64
+				for _, fieldScore := range fields {
+					score += fieldScore
+				}
+				scores[movie] = max(scores[movie], weight*score)
+			}
+		}
+		return scores
+	}
+	wordScores := make([]map[int][]float64, len(clause.phrase))
+	for k, word := range clause.phrase {
+		wordScores[k] = s.fieldScores(word)
+	}
+	for movie := range wordScores[0] {
+		for f, tokens := range s.fields[movie] {
+			if !clause.matches([][]searchToken{tokens}) {
+				continue
+			}
+			for k := range wordScores {
+				scores[movie] += phraseBoost * wordScores[k][movie][f]
+			}
+		}
+	}
+	return scores
+}
+
+func (s *MemoryMovieSearcher) Search(ctx context.Context, query SearchQuery, limit int) ([]models.MovieSearchResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	clauses := expandSearchQuery(query, s.vocabulary)
+	var totals map[int]float64
+	for _, clause := range clauses {
+		scores := s.clauseScores(clause)
+		if totals == nil {
+			totals = scores
+			continue
+		}
+		// every clause must match
+		for movie := range totals {
+			if score, ok := scores[movie]; ok {
+				totals[movie] += score
+			} else {
+				delete(totals, movie)
+			}
+		}
+	}
+	ranked := make([]int, 0, len(totals))
+	for movie := range totals {
+		ranked = append(ranked, movie)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if totals[ranked[i]] != totals[ranked[j]] {
+			return totals[ranked[i]] > totals[ranked[j]]
+		}
+		return s.movies[ranked[i]].Title < s.movies[ranked[j]].Title
+	})
+	results := []models.MovieSearchResult{}
+	for _, movie := range ranked[:min(limit, len(ranked))] {
+		results = append(results, models.MovieSearchResult{
+			Movie:      s.movies[movie],
+			Score:      totals[movie],
+			Highlights: movieHighlights(s.movies[movie], s.fields[movie], clauses),
+		})
+	}
+	return results, nil
+}
+
+var movieSearcher = mustConfigureMovieSearch()
+
+func mustConfigureMovieSearch() MovieSearcher {
+	for _, searcher := range []MovieSearcher{&MongoTextSearcher{}, &MemoryMovieSearcher{}} {
+		if searcher.Name() == config.Env.MOVIE_SEARCH_BACKEND {
+			return searcher
+		}
+	}
+	log.Fatalf("❌ Unknown MOVIE_SEARCH_BACKEND %q, expected mongo or memory", config.Env.MOVIE_SEARCH_BACKEND)
+	return nil
+}
+
+func SearchMovies(query SearchQuery, limit int) ([]models.MovieSearchResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return movieSearcher.Search(ctx, query, limit)
+}
+
+// RefreshMovieSearch reloads the catalogue, or as much of it as it needs,
+// into the configured searcher.
+func RefreshMovieSearch() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	findOptions := options.Find()
+	if projection := movieSearcher.Projection(); projection != nil {
+		findOptions.SetProjection(projection)
+	}
+	cursor, err := movieCollection.Find(ctx, bson.M{}, findOptions)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	movies := []models.Movie{}
+	if err := cursor.All(ctx, &movies); err != nil {
+		return err
+	}
+	movieSearcher.Refresh(movies)
+	return nil
+}
+
+// RunMovieSearchRefresh keeps the searcher in step with the catalogue; edits
+// show up in search results within one interval.
+func RunMovieSearchRefresh(interval time.Duration) {
+	for {
+		if err := RefreshMovieSearch(); err != nil {
+			log.Println("Failed to refresh movie search:", err)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ardiannm/go/models"
+)
+
+func TestMemoryMovieSearcherRanking(t *testing.T) {
+	searcher := &MemoryMovieSearcher{}
+	searcher.Refresh([]models.Movie{
+		{Title: "The Dark Knight", AdminReview: "Batman faces the Joker in Gotham."},
+		{Title: "Knight and Day", AdminReview: "A light comedy with a dark twist."},
+		{Title: "Dark City", AdminReview: "A stranger wakes up in a city the sun never reaches."},
+		{Title: "Batman Begins", AdminReview: "The dark knight is born after years of training."},
+		{Title: "Paddington", AdminReview: "A bear from Peru moves to London."},
+	})
+	tests := []struct {
+		q     string
+		limit int
+		want  []string
+	}{
+		// equal scores fall back to the title
+		{"knight", 10, []string{"Knight and Day", "The Dark Knight", "Batman Begins"}},
+		// a phrase in the title outranks the same phrase in a review, and
+		// both words apart are no match
+		{`"dark knight"`, 10, []string{"The Dark Knight", "Batman Begins"}},
+		// every word must match, and matches in the title count for more
+		{"dark knight", 10, []string{"The Dark Knight", "Knight and Day", "Batman Begins"}},
+		// swapped letters are one typo
+		{"knigth", 10, []string{"Knight and Day", "The Dark Knight", "Batman Begins"}},
+		{"bat*", 10, []string{"Batman Begins", "The Dark Knight"}},
+		{"knight", 2, []string{"Knight and Day", "The Dark Knight"}},
+		{"zebra", 10, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			query, err := ParseSearchQuery(tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			results, err := searcher.Search(context.Background(), query, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			titles := []string{}
+			for i, result := range results {
+				titles = append(titles, result.Movie.Title)
+				if i > 0 && result.Score > results[i-1].Score {
+					t.Errorf("%q scores higher than the result before it", result.Movie.Title)
+				}
+			}
+			if !reflect.DeepEqual(titles, tt.want) {
+				t.Fatalf("got %v, want %v", titles, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryMovieSearcherHighlights(t *testing.T) {
+	searcher := &MemoryMovieSearcher{}
+	searcher.Refresh([]models.Movie{{Title: "The Dark Knight", AdminReview: "Batman faces the Joker."}})
+	query, _ := ParseSearchQuery(`"dark knight"`)
+	results, err := searcher.Search(context.Background(), query, 10)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("got %v, %v", results, err)
+	}
+	want := map[string]string{"title": "The <mark>Dark</mark> <mark>Knight</mark>"}
+	if !reflect.DeepEqual(results[0].Highlights, want) {
+		t.Fatalf("highlights = %v, want %v", results[0].Highlights, want)
+	}
+}
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"context"
+	"time"
+
+	"github.com/ardiannm/go/database"
+	"github.com/ardiannm/go/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+var oidcStateCollection *mongo.Collection = database.OpenCollection("oidc_states")
+
+func SaveOIDCState(state models.OIDCState) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := oidcStateCollection.InsertOne(ctx, state)
+	return err
+}
+
+// ConsumeOIDCState returns and deletes the pending request, so every state
+// value is accepted at most once.
+func ConsumeOIDCState(state, provider string) (models.OIDCState, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var found models.OIDCState
+	filter := bson.M{"state": state, "provider": provider, "expires_at": bson.M{"$gt": time.Now()}}
+	err := oidcStateCollection.FindOneAndDelete(ctx, filter).Decode(&found)
+	return found, err
+}
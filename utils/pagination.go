@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// PageCursor marks the last document of a page for keyset pagination: the
+// value of the sort field and the _id that breaks ties. Sort records which
+// ordering it belongs to, so a cursor cannot be replayed against another.
+type PageCursor struct {
+	Sort  string        `bson:"s"`
+	Value any           `bson:"v"`
+	ID    bson.ObjectID `bson:"id"`
+}
+
+func EncodeCursor(cursor PageCursor) (string, error) {
+	raw, err := bson.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// DecodeCursor parses a cursor issued for the given sort. Only scalar values
+// are accepted, so a forged cursor cannot smuggle query operators in.
+func DecodeCursor(encoded, sort string) (PageCursor, error) {
+	var cursor PageCursor
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor, errors.New("Malformed cursor")
+	}
+	if err := bson.Unmarshal(raw, &cursor); err != nil {
+		return cursor, errors.New("Malformed cursor")
+	}
+	if cursor.Sort != sort {
+		return cursor, errors.New("Cursor does not match the requested sort")
+	}
+	switch cursor.Value.(type) {
+	case string, bson.DateTime, int32, int64, float64, nil:
+	default:
+		return cursor, errors.New("Malformed cursor")
+	}
+	return cursor, nil
+}
+
+// AfterCursor is the filter selecting documents that sort after cursor when
+// ordering by field and then _id in the same direction.
+func AfterCursor(field string, descending bool, cursor PageCursor) bson.M {
+	op := "$gt"
+	if descending {
+		op = "$lt"
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{field: bson.M{op: cursor.Value}},
+		bson.M{field: bson.M{"$eq": cursor.Value}, "_id": bson.M{op: cursor.ID}},
+	}}
+}
+
+// PageSize reads a limit query value, falling back to DefaultPageSize and
+// capping at MaxPageSize.
+func PageSize(value string) (int64, error) {
+	if value == "" {
+		return DefaultPageSize, nil
+	}
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || limit < 1 {
+		return 0, errors.New("limit must be a positive integer")
+	}
+	return min(limit, MaxPageSize), nil
+}
+
+// SetPageLinks sets an RFC 8288 Link header pointing at the first page and,
+// when there is one, the next page of the current request.
+func SetPageLinks(ctx *gin.Context, nextCursor string) {
+	query := ctx.Request.URL.Query()
+	query.Del("cursor")
+	links := []string{"<" + ctx.Request.URL.Path + "?" + query.Encode() + `>; rel="first"`}
+	if nextCursor != "" {
+		query.Set("cursor", nextCursor)
+		links = append(links, "<"+ctx.Request.URL.Path+"?"+query.Encode()+`>; rel="next"`)
+	}
+	ctx.Header("Link", strings.Join(links, ", "))
+}
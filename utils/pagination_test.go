@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	id := bson.NewObjectID()
+	values := []any{
+		"The Dark Knight",
+		int32(9),
+		int64(1) << 40,
+		7.5,
+		bson.NewDateTimeFromTime(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)),
+		nil,
+	}
+	for _, value := range values {
+		cursor := PageCursor{Sort: "title", Value: value, ID: id}
+		encoded, err := EncodeCursor(cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := DecodeCursor(encoded, "title")
+		if err != nil {
+			t.Fatalf("DecodeCursor(%v): %v", value, err)
+		}
+		if !reflect.DeepEqual(decoded, cursor) {
+			t.Errorf("round trip of %v gave %+v", value, decoded)
+		}
+	}
+}
+
+func TestDecodeCursorRejectsOtherSorts(t *testing.T) {
+	encoded, err := EncodeCursor(PageCursor{Sort: "title", Value: "Alien", ID: bson.NewObjectID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sort := range []string{"-title", "ranking_value", ""} {
+		if _, err := DecodeCursor(encoded, sort); err == nil {
+			t.Errorf("cursor for title accepted for %q", sort)
+		}
+	}
+}
+
+func TestDecodeCursorRejectsOperators(t *testing.T) {
+	values := []any{
+		bson.M{"$ne": nil},
+		bson.D{{Key: "$gt", Value: ""}},
+		bson.A{"Alien", "Aliens"},
+		bson.Regex{Pattern: ".*"},
+		true,
+	}
+	for _, value := range values {
+		encoded, err := EncodeCursor(PageCursor{Sort: "title", Value: value, ID: bson.NewObjectID()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := DecodeCursor(encoded, "title"); err == nil {
+			t.Errorf("cursor with value %v accepted", value)
+		}
+	}
+	for _, encoded := range []string{"", "not base64!", base64.RawURLEncoding.EncodeToString([]byte("not bson"))} {
+		if _, err := DecodeCursor(encoded, "title"); err == nil {
+			t.Errorf("malformed cursor %q accepted", encoded)
+		}
+	}
+}
+
+func TestAfterCursor(t *testing.T) {
+	id := bson.NewObjectID()
+	cursor := PageCursor{Sort: "title", Value: "Alien", ID: id}
+	tests := []struct {
+		descending bool
+		op         string
+	}{
+		{false, "$gt"},
+		{true, "$lt"},
+	}
+	for _, tt := range tests {
+		// later values, or the same value with a later _id in the same
+		// direction
+		want := bson.M{"$or": bson.A{
+			bson.M{"title": bson.M{tt.op: "Alien"}},
+			bson.M{"title": bson.M{"$eq": "Alien"}, "_id": bson.M{tt.op: id}},
+		}}
+		if got := AfterCursor("title", tt.descending, cursor); !reflect.DeepEqual(got, want) {
+			t.Errorf("AfterCursor(descending=%v) = %v, want %v", tt.descending, got, want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/ardiannm/go/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher is one password hashing algorithm. Encoded hashes name
+// their algorithm and parameters, so hashes of every supported algorithm
+// can be verified side by side while new ones use the configured one.
+type PasswordHasher interface {
+	Name() string
+	Hash(password string) (string, error)
+	// Recognizes reports whether encoded was produced by this algorithm.
+	Recognizes(encoded string) bool
+	Verify(encoded, password string) (bool, error)
+	// Outdated reports whether encoded uses other parameters than the
+	// hasher is configured with.
+	Outdated(encoded string) bool
+}
+
+// BcryptHasher produces the usual $2a$<cost>$... hashes.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Name() string { return "bcrypt" }
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h BcryptHasher) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (h BcryptHasher) Verify(encoded, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h BcryptHasher) Outdated(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
+}
+
+// Argon2idHasher produces hashes in the PHC string format,
+// $argon2id$v=19$m=<KiB>,t=<iterations>,p=<parallelism>$<salt>$<key>.
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  int
+	KeyLength   uint32
+}
+
+type argon2idParams struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func (h Argon2idHasher) Name() string { return "argon2id" }
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h Argon2idHasher) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (h Argon2idHasher) Verify(encoded, password string) (bool, error) {
+	params, err := parseArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey([]byte(password), params.salt, params.iterations, params.memory, params.parallelism, uint32(len(params.key)))
+	return subtle.ConstantTimeCompare(key, params.key) == 1, nil
+}
+
+func (h Argon2idHasher) Outdated(encoded string) bool {
+	params, err := parseArgon2id(encoded)
+	return err != nil ||
+		params.memory != h.Memory ||
+		params.iterations != h.Iterations ||
+		params.parallelism != h.Parallelism ||
+		len(params.salt) != h.SaltLength ||
+		uint32(len(params.key)) != h.KeyLength
+}
+
+func parseArgon2id(encoded string) (argon2idParams, error) {
+	var params argon2idParams
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, errors.New("Malformed argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, errors.New("Unsupported argon2id version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return params, errors.New("Malformed argon2id parameters")
+	}
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return params, errors.New("Malformed argon2id salt")
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(params.key) == 0 {
+		return params, errors.New("Malformed argon2id key")
+	}
+	return params, nil
+}
+
+var passwordHashers, preferredHasher = mustConfigurePasswordHashers()
+
+func mustConfigurePasswordHashers() ([]PasswordHasher, PasswordHasher) {
+	hashers := []PasswordHasher{
+		BcryptHasher{Cost: int(config.Env.BCRYPT_COST)},
+		Argon2idHasher{
+			Memory:      uint32(config.Env.ARGON2_MEMORY_KIB),
+			Iterations:  uint32(config.Env.ARGON2_ITERATIONS),
+			Parallelism: uint8(config.Env.ARGON2_PARALLELISM),
+			SaltLength:  16,
+			KeyLength:   32,
+		},
+	}
+	for _, hasher := range hashers {
+		if hasher.Name() == config.Env.PASSWORD_HASH_ALGORITHM {
+			return hashers, hasher
+		}
+	}
+	log.Fatalf("❌ Unknown PASSWORD_HASH_ALGORITHM %q, expected bcrypt or argon2id", config.Env.PASSWORD_HASH_ALGORITHM)
+	return nil, nil
+}
+
+// HashPassword hashes with the configured algorithm and parameters.
+func HashPassword(password string) (string, error) {
+	return preferredHasher.Hash(password)
+}
+
+// VerifyPassword checks password against a stored hash of any supported
+// algorithm. needsRehash is set when the password matched but the hash
+// should be replaced with one from HashPassword.
+func VerifyPassword(encoded, password string) (ok bool, needsRehash bool, err error) {
+	for _, hasher := range passwordHashers {
+		if !hasher.Recognizes(encoded) {
+			continue
+		}
+		ok, err := hasher.Verify(encoded, password)
+		if err != nil || !ok {
+			return false, false, err
+		}
+		return true, hasher.Name() != preferredHasher.Name() || hasher.Outdated(encoded), nil
+	}
+	return false, false, errors.New("Unrecognized password hash")
+}
@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// cheap parameters, the configured ones would make the tests slow
+var (
+	testBcrypt   = BcryptHasher{Cost: bcrypt.MinCost}
+	testArgon2id = Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+)
+
+// usePasswordHashers configures preferred for the rest of the test, as
+// mustConfigurePasswordHashers would: it hashes, and verifies next to the
+// test hasher of the other algorithm.
+func usePasswordHashers(t *testing.T, preferred PasswordHasher) {
+	t.Helper()
+	savedHashers, savedPreferred := passwordHashers, preferredHasher
+	t.Cleanup(func() { passwordHashers, preferredHasher = savedHashers, savedPreferred })
+	hashers := []PasswordHasher{preferred}
+	for _, hasher := range []PasswordHasher{testBcrypt, testArgon2id} {
+		if hasher.Name() != preferred.Name() {
+			hashers = append(hashers, hasher)
+		}
+	}
+	passwordHashers, preferredHasher = hashers, preferred
+}
+
+func mustHash(t *testing.T, hasher PasswordHasher, password string) string {
+	t.Helper()
+	encoded, err := hasher.Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
+
+func TestVerifyPasswordRoundTrip(t *testing.T) {
+	for _, hasher := range []PasswordHasher{testBcrypt, testArgon2id} {
+		t.Run(hasher.Name(), func(t *testing.T) {
+			usePasswordHashers(t, hasher)
+			encoded, err := HashPassword("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !hasher.Recognizes(encoded) {
+				t.Fatalf("%s does not recognize its own hash %q", hasher.Name(), encoded)
+			}
+			if ok, needsRehash, err := VerifyPassword(encoded, "correct horse"); !ok || needsRehash || err != nil {
+				t.Fatalf("VerifyPassword(right password) = %v, %v, %v", ok, needsRehash, err)
+			}
+			if ok, needsRehash, err := VerifyPassword(encoded, "correct horse!"); ok || needsRehash || err != nil {
+				t.Fatalf("VerifyPassword(wrong password) = %v, %v, %v", ok, needsRehash, err)
+			}
+			if again := mustHash(t, hasher, "correct horse"); again == encoded {
+				t.Fatal("two hashes of the same password share a salt")
+			}
+		})
+	}
+}
+
+func TestVerifyPasswordNeedsRehash(t *testing.T) {
+	tests := []struct {
+		name      string
+		hashedBy  PasswordHasher
+		preferred PasswordHasher
+		want      bool
+	}{
+		{"same bcrypt cost", testBcrypt, testBcrypt, false},
+		{"bcrypt cost raised", BcryptHasher{Cost: bcrypt.MinCost}, BcryptHasher{Cost: bcrypt.MinCost + 1}, true},
+		{"same argon2id parameters", testArgon2id, testArgon2id, false},
+		{"argon2id memory raised", testArgon2id, Argon2idHasher{Memory: 128, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}, true},
+		{"argon2id iterations raised", testArgon2id, Argon2idHasher{Memory: 64, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}, true},
+		{"argon2id key lengthened", testArgon2id, Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 64}, true},
+		{"bcrypt to argon2id", testBcrypt, testArgon2id, true},
+		{"argon2id to bcrypt", testArgon2id, testBcrypt, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usePasswordHashers(t, tt.preferred)
+			// hashes keep their parameters, so they verify whatever is
+			// configured now
+			encoded := mustHash(t, tt.hashedBy, "correct horse")
+			ok, needsRehash, err := VerifyPassword(encoded, "correct horse")
+			if !ok || err != nil {
+				t.Fatalf("VerifyPassword = %v, %v", ok, err)
+			}
+			if needsRehash != tt.want {
+				t.Fatalf("needsRehash = %v, want %v", needsRehash, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyPasswordRejectsBadHashes(t *testing.T) {
+	usePasswordHashers(t, testArgon2id)
+	valid := mustHash(t, testArgon2id, "correct horse")
+	parts := strings.Split(valid, "$")
+	withPart := func(i int, value string) string {
+		changed := append([]string{}, parts...)
+		changed[i] = value
+		return strings.Join(changed, "$")
+	}
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"empty", ""},
+		{"plain text", "correct horse"},
+		{"unknown algorithm", "$scrypt$ln=15,r=8,p=1$c2FsdA$a2V5"},
+		{"argon2i", withPart(1, "argon2i")},
+		{"missing key", strings.Join(parts[:5], "$")},
+		{"extra field", valid + "$extra"},
+		{"other version", withPart(2, "v=16")},
+		{"version not a number", withPart(2, "v=x")},
+		{"parameters out of order", withPart(3, "t=1,m=64,p=1")},
+		{"parameters missing", withPart(3, "m=64")},
+		{"salt not base64", withPart(4, "not base64!")},
+		{"key not base64", withPart(5, "not base64!")},
+		{"empty key", withPart(5, "")},
+		{"truncated bcrypt", "$2a$04$tooShort"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, needsRehash, err := VerifyPassword(tt.encoded, "correct horse")
+			if ok || needsRehash || err == nil {
+				t.Fatalf("VerifyPassword(%q) = %v, %v, %v, want an error", tt.encoded, ok, needsRehash, err)
+			}
+		})
+	}
+}
+
+func TestParseArgon2id(t *testing.T) {
+	params, err := parseArgon2id("$argon2id$v=19$m=65536,t=3,p=2$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.memory != 65536 || params.iterations != 3 || params.parallelism != 2 {
+		t.Fatalf("m=%d t=%d p=%d", params.memory, params.iterations, params.parallelism)
+	}
+	if string(params.salt) != "saltsaltsaltsalt" || len(params.key) != 29 {
+		t.Fatalf("salt %q, key of %d bytes", params.salt, len(params.key))
+	}
+	// a hash that cannot be parsed is always replaced
+	if !testArgon2id.Outdated("$argon2id$garbage") || !testBcrypt.Outdated("$2a$garbage") {
+		t.Fatal("unparseable hashes must count as outdated")
+	}
+}
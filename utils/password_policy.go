@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ardiannm/go/config"
+	"github.com/ardiannm/go/models"
+)
+
+// PasswordPolicyViolations lists every rule of the configured password policy
+// that password breaks for user; it is empty when the password is
+// acceptable. user only needs the email and names filled in.
+func PasswordPolicyViolations(password string, user models.User) ([]string, error) {
+	violations := []string{}
+	if minLength := config.Env.PASSWORD_MIN_LENGTH; int64(utf8.RuneCountInString(password)) < minLength {
+		violations = append(violations, "must be at least "+strconv.FormatInt(minLength, 10)+" characters long")
+	}
+	// bcrypt ignores everything past 72 bytes
+	if maxBytes := config.Env.PASSWORD_MAX_BYTES; int64(len(password)) > maxBytes {
+		violations = append(violations, "must be at most "+strconv.FormatInt(maxBytes, 10)+" bytes long")
+	}
+	if minClasses := config.Env.PASSWORD_MIN_CHARACTER_CLASSES; characterClasses(password) < minClasses {
+		violations = append(violations, "must mix at least "+strconv.FormatInt(minClasses, 10)+" of lowercase letters, uppercase letters, digits and symbols")
+	}
+	if config.Env.PASSWORD_DISALLOW_PERSONAL_INFO && containsPersonalInfo(password, user) {
+		violations = append(violations, "must not contain your name or email address")
+	}
+	if breachedPasswords != nil {
+		count, err := breachedPasswords.Count(password)
+		if err != nil {
+			return nil, err
+		}
+		if count >= config.Env.BREACHED_PASSWORD_MIN_COUNT {
+			violations = append(violations, "has appeared in a data breach, please choose another")
+		}
+	}
+	return violations, nil
+}
+
+func characterClasses(password string) int64 {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	var classes int64
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			classes++
+		}
+	}
+	return classes
+}
+
+func containsPersonalInfo(password string, user models.User) bool {
+	password = strings.ToLower(password)
+	localPart, _, _ := strings.Cut(user.Email, "@")
+	for _, value := range []string{user.Email, localPart, user.FirstName, user.LastName} {
+		value = strings.ToLower(strings.TrimSpace(value))
+		// very short names would reject too many ordinary passwords
+		if utf8.RuneCountInString(value) >= 3 && strings.Contains(password, value) {
+			return true
+		}
+	}
+	return false
+}
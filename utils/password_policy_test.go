@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ardiannm/go/config"
+	"github.com/ardiannm/go/models"
+)
+
+func TestPasswordPolicyViolations(t *testing.T) {
+	saved, savedList := config.Env, breachedPasswords
+	t.Cleanup(func() { config.Env, breachedPasswords = saved, savedList })
+	config.Env.PASSWORD_MIN_LENGTH = 8
+	config.Env.PASSWORD_MAX_BYTES = 72
+	config.Env.PASSWORD_MIN_CHARACTER_CLASSES = 3
+	config.Env.PASSWORD_DISALLOW_PERSONAL_INFO = true
+	config.Env.BREACHED_PASSWORD_MIN_COUNT = 2
+	breachedPasswords = openBreachedPasswordsFixture(t)
+
+	user := models.User{FirstName: "Ada", LastName: "Lovelace", Email: "countess@example.com"}
+	const (
+		tooShort  = "must be at least 8 characters long"
+		tooLong   = "must be at most 72 bytes long"
+		tooPlain  = "must mix at least 3 of lowercase letters, uppercase letters, digits and symbols"
+		personal  = "must not contain your name or email address"
+		breached  = "has appeared in a data breach, please choose another"
+		fiveBytes = "é€"
+	)
+	tests := []struct {
+		name     string
+		password string
+		user     models.User
+		want     []string
+	}{
+		{"acceptable", "Tr0ub4dor&3", user, nil},
+		{"too short", "Ab1!", user, []string{tooShort}},
+		// length counts characters, the limit bytes
+		{"multibyte characters count once", "Ab1" + fiveBytes + "xyz", user, nil},
+		{"too many bytes", "Ab1" + strings.Repeat(fiveBytes, 15), user, []string{tooLong}},
+		{"too few character classes", "abcdefgh1", user, []string{tooPlain}},
+		{"symbols count as a class", "abcdefgh!1", user, nil},
+		{"last name", "xLOVELACE9!", user, []string{personal}},
+		{"email local part", "Countess-99", user, []string{personal}},
+		{"short names are ignored", "Al-is-2-cool", models.User{FirstName: "Al", Email: "al@example.com"}, nil},
+		{"breached", "password", user, []string{tooPlain, breached}},
+		// the fixture lists 123456 without a count, which reads as 1
+		{"seen less often than the minimum", "123456", user, []string{tooShort, tooPlain}},
+		{"several rules at once", "Ada", models.User{FirstName: "Ada"}, []string{tooShort, tooPlain, personal}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PasswordPolicyViolations(tt.password, tt.user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("PasswordPolicyViolations(%q) = %q, want %q", tt.password, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("personal info allowed", func(t *testing.T) {
+		config.Env.PASSWORD_DISALLOW_PERSONAL_INFO = false
+		t.Cleanup(func() { config.Env.PASSWORD_DISALLOW_PERSONAL_INFO = true })
+		if got, _ := PasswordPolicyViolations("xLOVELACE9!", user); len(got) != 0 {
+			t.Fatalf("got %q", got)
+		}
+	})
+}
+
+func TestCharacterClasses(t *testing.T) {
+	tests := []struct {
+		password string
+		want     int64
+	}{
+		{"", 0},
+		{"abc", 1},
+		{"abcDEF", 2},
+		{"abcDEF123", 3},
+		{"abcDEF123 ", 4},
+		{"ÄÖÜ", 1},
+		{"日本語", 1},
+	}
+	for _, tt := range tests {
+		if got := characterClasses(tt.password); got != tt.want {
+			t.Errorf("characterClasses(%q) = %d, want %d", tt.password, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"context"
+	"time"
+
+	"github.com/ardiannm/go/database"
+	"github.com/ardiannm/go/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var revokedTokenCollection *mongo.Collection = database.OpenCollection("revoked_tokens")
+
+// RevokeAllUserTokens signs the user out of every session and invalidates
+// every token issued to them up to now.
+func RevokeAllUserTokens(userId string) error {
+	return RevokeUsersTokens([]string{userId})
+}
+
+// RevokeUsersTokens is RevokeAllUserTokens for many users at once, in one
+// delete and one insert however many there are.
+func RevokeUsersTokens(userIds []string) error {
+	if len(userIds) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := sessionCollection.DeleteMany(ctx, bson.M{"user_id": bson.M{"$in": userIds}}); err != nil {
+		return err
+	}
+	now := time.Now()
+	revocations := make([]models.RevokedToken, len(userIds))
+	for i, userId := range userIds {
+		revocations[i] = models.RevokedToken{
+			UserID: userId,
+			// token issue times only have whole seconds; a token issued earlier
+			// in this second is still refused because its session is gone
+			RevokedBefore: now.Truncate(time.Second),
+			ExpiresAt:     now.Add(RefreshTokenLifetime),
+		}
+	}
+	_, err := revokedTokenCollection.InsertMany(ctx, revocations)
+	return err
+}
+
+func IsTokenRevoked(claims *SignedDetails) (bool, error) {
+	if claims.IssuedAt == nil {
+		return false, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	filter := bson.M{
+		"user_id":        claims.UserID,
+		"revoked_before": bson.M{"$gt": claims.IssuedAt.Time},
+	}
+	count, err := revokedTokenCollection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
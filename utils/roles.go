@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/ardiannm/go/database"
+	"github.com/ardiannm/go/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var roleCollection *mongo.Collection = database.OpenCollection("roles")
+
+// EnsureDefaultRoles creates the built-in roles when missing. ADMIN's
+// permission list is rewritten every time so it picks up new permissions.
+func EnsureDefaultRoles() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, role := range models.DefaultRoles {
+		now := time.Now()
+		update := bson.M{"$setOnInsert": bson.M{
+			"description": role.Description,
+			"permissions": role.Permissions,
+			"built_in":    true,
+			"created_at":  now,
+			"updated_at":  now,
+		}}
+		if role.Name == models.ADMIN {
+			update = bson.M{
+				"$setOnInsert": bson.M{"description": role.Description, "built_in": true, "created_at": now},
+				"$set":         bson.M{"permissions": models.AllPermissions, "updated_at": now},
+			}
+		}
+		_, err := roleCollection.UpdateOne(ctx, bson.M{"name": role.Name}, update, options.UpdateOne().SetUpsert(true))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResolvePermissions returns the union of the permissions granted by roles.
+func ResolvePermissions(roles []models.UserRole) ([]models.Permission, error) {
+	if slices.Contains(roles, models.ADMIN) {
+		return slices.Clone(models.AllPermissions), nil
+	}
+	if len(roles) == 0 {
+		return []models.Permission{}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cursor, err := roleCollection.Find(ctx, bson.M{"name": bson.M{"$in": roles}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var found []models.Role
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	permissions := []models.Permission{}
+	for _, role := range found {
+		for _, permission := range role.Permissions {
+			if !slices.Contains(permissions, permission) {
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	slices.Sort(permissions)
+	return permissions, nil
+}
+
+// EffectiveRoles are the roles a user's credentials carry; ADMIN is withheld
+// until the user enrolls in two-factor authentication.
+func EffectiveRoles(user models.User) []models.UserRole {
+	roles := []models.UserRole{}
+	for _, role := range user.RoleNames() {
+		if role == models.ADMIN && !user.TwoFactorEnabled() {
+			continue
+		}
+		roles = append(roles, role)
+	}
+	return roles
+}
+
+// PrimaryRole picks the single role reported in the legacy Role claim.
+func PrimaryRole(roles []models.UserRole) models.UserRole {
+	if slices.Contains(roles, models.ADMIN) {
+		return models.ADMIN
+	}
+	return models.USER
+}
@@ -0,0 +1,322 @@
+package utils
+
+import (
+	"errors"
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	maxSearchClauses    = 10
+	maxPrefixExpansions = 50
+	// typo and prefix matches count for less than the word itself
+	typoWeight   = 0.5
+	prefixWeight = 0.8
+)
+
+// SearchQuery is a parsed search string. Plain words may match with small
+// typos, words ending in * match as prefixes and "quoted words" must appear
+// together in that order.
+type SearchQuery struct {
+	Terms    []string
+	Prefixes []string
+	Phrases  [][]string
+}
+
+// ParseSearchQuery splits q into words, prefixes and phrases. Everything but
+// letters and digits is dropped, so no backend operator can be injected.
+func ParseSearchQuery(q string) (SearchQuery, error) {
+	var query SearchQuery
+	for i, part := range strings.Split(q, `"`) {
+		// every other part sits between quotes
+		if i%2 == 1 {
+			words := searchWords(part)
+			if len(words) > 0 {
+				query.Phrases = append(query.Phrases, words)
+			}
+			continue
+		}
+		for _, field := range strings.Fields(part) {
+			words := searchWords(field)
+			if len(words) == 0 {
+				continue
+			}
+			if strings.HasSuffix(field, "*") {
+				prefix := words[len(words)-1]
+				if utf8.RuneCountInString(prefix) < 2 {
+					return query, errors.New("Prefix searches need at least 2 letters")
+				}
+				query.Terms = append(query.Terms, words[:len(words)-1]...)
+				query.Prefixes = append(query.Prefixes, prefix)
+				continue
+			}
+			query.Terms = append(query.Terms, words...)
+		}
+	}
+	clauses := len(query.Terms) + len(query.Prefixes) + len(query.Phrases)
+	if clauses == 0 {
+		return query, errors.New("Search query must contain at least one word")
+	}
+	if clauses > maxSearchClauses {
+		return query, errors.New("Search query is limited to 10 words and phrases")
+	}
+	return query, nil
+}
+
+// searchToken is a lower-cased word of a text and where it sits in it.
+type searchToken struct {
+	Word       string
+	Start, End int
+}
+
+func tokenize(text string) []searchToken {
+	var tokens []searchToken
+	start := -1
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, searchToken{Word: strings.ToLower(text[start:i]), Start: start, End: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, searchToken{Word: strings.ToLower(text[start:]), Start: start, End: len(text)})
+	}
+	return tokens
+}
+
+func searchWords(text string) []string {
+	var words []string
+	for _, token := range tokenize(text) {
+		words = append(words, token.Word)
+	}
+	return words
+}
+
+// searchVocabulary is the sorted set of words in the catalogue, used to
+// expand prefixes and to correct typos.
+type searchVocabulary []string
+
+func newSearchVocabulary(words map[string]bool) searchVocabulary {
+	vocabulary := make(searchVocabulary, 0, len(words))
+	for word := range words {
+		vocabulary = append(vocabulary, word)
+	}
+	sort.Strings(vocabulary)
+	return vocabulary
+}
+
+func (v searchVocabulary) withPrefix(prefix string) []string {
+	var words []string
+	for i := sort.SearchStrings(v, prefix); i < len(v) && strings.HasPrefix(v[i], prefix); i++ {
+		if len(words) == maxPrefixExpansions {
+			break
+		}
+		words = append(words, v[i])
+	}
+	return words
+}
+
+// similar returns the words within the typos allowed for word, other than
+// word itself.
+func (v searchVocabulary) similar(word string) []string {
+	limit := allowedTypos(word)
+	if limit == 0 {
+		return nil
+	}
+	length := utf8.RuneCountInString(word)
+	var words []string
+	for _, candidate := range v {
+		if candidate == word {
+			continue
+		}
+		if d := utf8.RuneCountInString(candidate) - length; d > limit || -d > limit {
+			continue
+		}
+		if editDistance(word, candidate, limit) <= limit {
+			words = append(words, candidate)
+		}
+	}
+	return words
+}
+
+// allowedTypos grows with the word, so short words are never "corrected"
+// into different ones.
+func allowedTypos(word string) int {
+	switch n := utf8.RuneCountInString(word); {
+	case n >= 8:
+		return 2
+	case n >= 4:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// editDistance is the Damerau-Levenshtein distance between a and b, counting
+// a swap of neighbouring letters as one typo. It gives up and returns
+// limit+1 once the distance must exceed limit.
+func editDistance(a, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				curr[j] = min(curr[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+	return prev[len(rb)]
+}
+
+// searchClause is one part of a query every hit must match: either one of
+// several weighted words or a phrase.
+type searchClause struct {
+	variants map[string]float64
+	phrase   []string
+}
+
+func expandSearchQuery(query SearchQuery, vocabulary searchVocabulary) []searchClause {
+	var clauses []searchClause
+	for _, term := range query.Terms {
+		variants := map[string]float64{term: 1}
+		for _, word := range vocabulary.similar(term) {
+			variants[word] = typoWeight
+		}
+		clauses = append(clauses, searchClause{variants: variants})
+	}
+	for _, prefix := range query.Prefixes {
+		variants := map[string]float64{prefix: 1}
+		for _, word := range vocabulary.withPrefix(prefix) {
+			if word != prefix {
+				variants[word] = prefixWeight
+			}
+		}
+		clauses = append(clauses, searchClause{variants: variants})
+	}
+	for _, phrase := range query.Phrases {
+		clauses = append(clauses, searchClause{phrase: phrase})
+	}
+	return clauses
+}
+
+// phraseAt reports whether phrase starts at tokens[i].
+func phraseAt(tokens []searchToken, i int, phrase []string) bool {
+	if i+len(phrase) > len(tokens) {
+		return false
+	}
+	for k, word := range phrase {
+		if tokens[i+k].Word != word {
+			return false
+		}
+	}
+	return true
+}
+
+// matches reports whether the clause matches any of the tokenized fields.
+func (c searchClause) matches(fields [][]searchToken) bool {
+	for _, tokens := range fields {
+		for i, token := range tokens {
+			if c.phrase != nil && phraseAt(tokens, i, c.phrase) {
+				return true
+			}
+			if _, ok := c.variants[token.Word]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// markMatches flags the tokens any of the clauses matched.
+func markMatches(tokens []searchToken, clauses []searchClause) []bool {
+	marked := make([]bool, len(tokens))
+	for _, clause := range clauses {
+		for i, token := range tokens {
+			if clause.phrase != nil {
+				if phraseAt(tokens, i, clause.phrase) {
+					for k := range clause.phrase {
+						marked[i+k] = true
+					}
+				}
+				continue
+			}
+			if _, ok := clause.variants[token.Word]; ok {
+				marked[i] = true
+			}
+		}
+	}
+	return marked
+}
+
+// searchSnippet returns text HTML-escaped with the marked tokens wrapped in
+// <mark>. With a window, long texts are cut to that many words around the
+// first match. It returns "" when nothing is marked.
+func searchSnippet(text string, tokens []searchToken, marked []bool, window int) string {
+	first := -1
+	for i, m := range marked {
+		if m {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return ""
+	}
+	from, to := 0, len(tokens)
+	if window > 0 && len(tokens) > window {
+		from = max(0, first-window/3)
+		to = min(len(tokens), from+window)
+		from = max(0, to-window)
+	}
+	start, end := 0, len(text)
+	if from > 0 {
+		start = tokens[from].Start
+	}
+	if to < len(tokens) {
+		end = tokens[to-1].End
+	}
+	var snippet strings.Builder
+	if start > 0 {
+		snippet.WriteString("…")
+	}
+	position := start
+	for i := from; i < to; i++ {
+		if !marked[i] {
+			continue
+		}
+		snippet.WriteString(html.EscapeString(text[position:tokens[i].Start]))
+		snippet.WriteString("<mark>" + html.EscapeString(text[tokens[i].Start:tokens[i].End]) + "</mark>")
+		position = tokens[i].End
+	}
+	snippet.WriteString(html.EscapeString(text[position:end]))
+	if end < len(text) {
+		snippet.WriteString("…")
+	}
+	return snippet.String()
+}
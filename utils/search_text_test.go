@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		q    string
+		want SearchQuery
+		// empty when the query must parse
+		err string
+	}{
+		{q: "Dark Knight", want: SearchQuery{Terms: []string{"dark", "knight"}}},
+		{q: `"the dark knight" rises`, want: SearchQuery{Terms: []string{"rises"}, Phrases: [][]string{{"the", "dark", "knight"}}}},
+		{q: `"dark knight" "gotham city"`, want: SearchQuery{Phrases: [][]string{{"dark", "knight"}, {"gotham", "city"}}}},
+		{q: `"unclosed phrase`, want: SearchQuery{Phrases: [][]string{{"unclosed", "phrase"}}}},
+		{q: "bat* knight", want: SearchQuery{Terms: []string{"knight"}, Prefixes: []string{"bat"}}},
+		{q: "spider-ma*", want: SearchQuery{Terms: []string{"spider"}, Prefixes: []string{"ma"}}},
+		{q: "b*", err: "Prefix searches need at least 2 letters"},
+		// operators of the text index and of queries never get through
+		{q: `-joker $where {$gt: 1} ~x`, want: SearchQuery{Terms: []string{"joker", "where", "gt", "1", "x"}}},
+		{q: "", err: "at least one word"},
+		{q: `"" !!! *`, err: "at least one word"},
+		{q: "a b c d e f g h i j", want: SearchQuery{Terms: strings.Fields("a b c d e f g h i j")}},
+		{q: "a b c d e f g h i j k", err: "limited to 10"},
+		{q: `a b c d e f g h i "j k"`, want: SearchQuery{Terms: strings.Fields("a b c d e f g h i"), Phrases: [][]string{{"j", "k"}}}},
+		{q: `a b c d e f g h i "j k" lo*`, err: "limited to 10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			got, err := ParseSearchQuery(tt.q)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{"matrix", "matrix", 0, 0},
+		{"matrix", "matrx", 1, 1},
+		{"matrix", "matrixx", 1, 1},
+		{"matrix", "mbtrix", 1, 1},
+		// a swap of neighbouring letters is one typo
+		{"matrix", "mtarix", 1, 1},
+		{"kitten", "sitting", 3, 3},
+		{"café", "cafe", 1, 1},
+		{"", "abc", 5, 3},
+		// past the limit the search gives up with limit+1
+		{"kitten", "sitting", 1, 2},
+		{"matrix", "xirtam", 2, 3},
+		{"abc", "xyz", 0, 1},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b, tt.limit); got != tt.want {
+			t.Errorf("editDistance(%q, %q, %d) = %d, want %d", tt.a, tt.b, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestSearchVocabulary(t *testing.T) {
+	vocabulary := newSearchVocabulary(map[string]bool{"mat": true, "matrix": true, "matrices": true, "cat": true, "batman": true})
+	if got, want := vocabulary.withPrefix("mat"), []string{"mat", "matrices", "matrix"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("withPrefix(mat) = %v, want %v", got, want)
+	}
+	if got, want := vocabulary.similar("matrx"), []string{"matrix"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("similar(matrx) = %v, want %v", got, want)
+	}
+	// three letters allow no typo, so cat is never corrected into mat
+	if got := vocabulary.similar("cat"); got != nil {
+		t.Errorf("similar(cat) = %v, want none", got)
+	}
+}
+
+func TestSearchSnippet(t *testing.T) {
+	words := "w0 w1 w2 w3 w4 w5 w6 w7 w8 w9"
+	tests := []struct {
+		name   string
+		text   string
+		match  string
+		window int
+		want   string
+	}{
+		{"no match", "the dark knight", "joker", 0, ""},
+		{"whole text", "the dark knight", "dark", 0, "the <mark>dark</mark> knight"},
+		{"escapes HTML", `Tom & Jerry <script>"cats"</script>`, "jerry", 0, "Tom &amp; <mark>Jerry</mark> &lt;script&gt;&#34;cats&#34;&lt;/script&gt;"},
+		{"escapes inside marks", "AT&T", "t", 0, "AT&amp;<mark>T</mark>"},
+		{"every occurrence", "dark, darker, dark", "dark", 0, "<mark>dark</mark>, darker, <mark>dark</mark>"},
+		{"window in the middle", words, "w5", 3, "…w4 <mark>w5</mark> w6…"},
+		{"window at the start", words, "w0", 3, "<mark>w0</mark> w1 w2…"},
+		{"window at the end", words, "w9", 3, "…w7 w8 <mark>w9</mark>"},
+		{"window wider than the text", words, "w5", 20, "w0 w1 w2 w3 w4 <mark>w5</mark> w6 w7 w8 w9"},
+		{"keeps punctuation at the ends of the text", "(w0) w1 w2.", "w1", 2, "…<mark>w1</mark> w2."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := tokenize(tt.text)
+			marked := markMatches(tokens, []searchClause{{variants: map[string]float64{tt.match: 1}}})
+			if got := searchSnippet(tt.text, tokens, marked, tt.window); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/ardiannm/go/database"
+	"github.com/ardiannm/go/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// last_seen_at is only rewritten once this much time has passed, so busy
+// clients do not turn every request into a write
+const sessionTouchInterval = time.Minute
+
+var sessionCollection *mongo.Collection = database.OpenCollection("sessions")
+
+func NewSessionID() string {
+	return bson.NewObjectID().Hex()
+}
+
+// CreateSession records a new signed-in device for the request. Clients may
+// name themselves with an X-Device-Label header; otherwise a label is
+// derived from the user agent.
+func CreateSession(ctx *gin.Context, userId, sessionID, refreshToken string) error {
+	mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	userAgent := ctx.Request.UserAgent()
+	label := strings.TrimSpace(ctx.GetHeader("X-Device-Label"))
+	if label == "" {
+		label = DeviceLabel(userAgent)
+	}
+	if len(label) > 100 {
+		label = label[:100]
+	}
+	now := time.Now()
+	_, err := sessionCollection.InsertOne(mongoCtx, models.Session{
+		SessionID:        sessionID,
+		UserID:           userId,
+		DeviceLabel:      label,
+		UserAgent:        userAgent,
+		IP:               ctx.ClientIP(),
+		RefreshTokenHash: HashSecureToken(refreshToken),
+		CreatedAt:        now,
+		LastSeenAt:       now,
+		ExpiresAt:        now.Add(RefreshTokenLifetime),
+	})
+	return err
+}
+
+// CreateImpersonationSession records the session behind an impersonation
+// token. It shows up in the user's session list, clearly labelled, and ends
+// with the token or when either side revokes it.
+func CreateImpersonationSession(ctx *gin.Context, userId, impersonatorId, sessionID string, expiresAt time.Time) error {
+	mongoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	now := time.Now()
+	_, err := sessionCollection.InsertOne(mongoCtx, models.Session{
+		SessionID:      sessionID,
+		UserID:         userId,
+		DeviceLabel:    "Support impersonation",
+		UserAgent:      ctx.Request.UserAgent(),
+		IP:             ctx.ClientIP(),
+		CreatedAt:      now,
+		LastSeenAt:     now,
+		ExpiresAt:      expiresAt,
+		ImpersonatorID: impersonatorId,
+	})
+	return err
+}
+
+func FindSession(userId, sessionID string) (models.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var session models.Session
+	filter := bson.M{"session_id": sessionID, "user_id": userId, "expires_at": bson.M{"$gt": time.Now()}}
+	err := sessionCollection.FindOne(ctx, filter).Decode(&session)
+	return session, err
+}
+
+func GetUserSessions(userId string) ([]models.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	sessions := []models.Session{}
+	filter := bson.M{"user_id": userId, "expires_at": bson.M{"$gt": time.Now()}}
+	cursor, err := sessionCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RotateSessionToken swaps the stored refresh token only if oldRefreshToken
+// is still the current one, so two concurrent refreshes cannot both succeed.
+// A successful rotation also extends the session.
+func RotateSessionToken(sessionID, oldRefreshToken, refreshToken string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	now := time.Now()
+	filter := bson.M{"session_id": sessionID, "refresh_token_hash": HashSecureToken(oldRefreshToken)}
+	update := bson.M{"$set": bson.M{
+		"refresh_token_hash": HashSecureToken(refreshToken),
+		"last_seen_at":       now,
+		"expires_at":         now.Add(RefreshTokenLifetime),
+	}}
+	result, err := sessionCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+// IsSessionActive reports whether the session a token was issued for still
+// exists, refreshing its last-seen time along the way.
+func IsSessionActive(claims *SignedDetails) (bool, error) {
+	if claims.SessionID == "" {
+		return false, nil
+	}
+	session, err := FindSession(claims.UserID, claims.SessionID)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if time.Since(session.LastSeenAt) < sessionTouchInterval {
+		return true, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = sessionCollection.UpdateOne(ctx, bson.M{"_id": session.ID}, bson.M{"$set": bson.M{"last_seen_at": time.Now()}})
+	return true, err
+}
+
+// DeleteSession signs one device out. It reports false when the user has no
+// such session.
+func DeleteSession(userId, sessionID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	result, err := sessionCollection.DeleteOne(ctx, bson.M{"session_id": sessionID, "user_id": userId})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount == 1, nil
+}
+
+// DeleteOtherSessions signs the user out everywhere except the given session.
+func DeleteOtherSessions(userId, keepSessionID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	filter := bson.M{"user_id": userId, "session_id": bson.M{"$ne": keepSessionID}}
+	result, err := sessionCollection.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// DeviceLabel turns a user agent into a short "Browser on OS" description.
+func DeviceLabel(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	if ua == "" {
+		return "Unknown device"
+	}
+	browser := "Unknown client"
+	for _, candidate := range []struct{ token, name string }{
+		{"edg/", "Edge"},
+		{"opr/", "Opera"},
+		{"firefox/", "Firefox"},
+		{"chrome/", "Chrome"},
+		{"safari/", "Safari"},
+		{"curl/", "curl"},
+		{"okhttp", "Android app"},
+		{"cfnetwork", "iOS app"},
+	} {
+		if strings.Contains(ua, candidate.token) {
+			browser = candidate.name
+			break
+		}
+	}
+	for _, candidate := range []struct{ token, name string }{
+		{"android", "Android"},
+		{"iphone", "iOS"},
+		{"ipad", "iPadOS"},
+		{"windows", "Windows"},
+		{"mac os x", "macOS"},
+		{"linux", "Linux"},
+	} {
+		if strings.Contains(ua, candidate.token) {
+			return browser + " on " + candidate.name
+		}
+	}
+	return browser
+}
@@ -1,8 +1,8 @@
 package utils
 
 import (
-	"context"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/ardiannm/go/config"
@@ -18,39 +18,68 @@ type SignedDetails struct {
 	Email     string
 	FirstName string
 	LastName  string
-	Role      models.UserRole
-	UserID    string
+	// Role is kept for verifiers that predate Roles
+	Role        models.UserRole
+	Roles       []models.UserRole
+	Permissions []models.Permission
+	UserID      string
+	SessionID   string
+	TokenUse    string
+	// ImpersonatorID is the admin acting as UserID in an impersonation token
+	ImpersonatorID string `json:",omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateAllTokens(email, firstName, lastName, userId string, role models.UserRole) (string, string, error) {
+const (
+	AccessTokenLifetime  = 24 * time.Hour
+	RefreshTokenLifetime = 24 * 7 * time.Hour
+)
+
+const (
+	TokenUseAccess        = "access"
+	TokenUseRefresh       = "refresh"
+	TokenUseChallenge     = "2fa_challenge"
+	TokenUseImpersonation = "impersonation"
+)
+
+func GenerateAllTokens(email, firstName, lastName, userId string, roles []models.UserRole, permissions []models.Permission, sessionID string) (string, string, error) {
+	role := PrimaryRole(roles)
 	claims := &SignedDetails{
-		Email:     email,
-		FirstName: firstName,
-		LastName:  lastName,
-		Role:      role,
-		UserID:    userId,
+		Email:       email,
+		FirstName:   firstName,
+		LastName:    lastName,
+		Role:        role,
+		Roles:       roles,
+		Permissions: permissions,
+		UserID:      userId,
+		SessionID:   sessionID,
+		TokenUse:    TokenUseAccess,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        bson.NewObjectID().Hex(),
 			Issuer:    "Gotrock",
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenLifetime)),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString([]byte(config.Env.SECRET_ACCESS_KEY))
+	signedToken, err := keyring.Sign(claims)
 	if err != nil {
 		return "", "", err
 	}
 	refreshClaims := &SignedDetails{
-		Email:     email,
-		FirstName: firstName,
-		LastName:  lastName,
-		Role:      role,
-		UserID:    userId,
+		Email:       email,
+		FirstName:   firstName,
+		LastName:    lastName,
+		Role:        role,
+		Roles:       roles,
+		Permissions: permissions,
+		UserID:      userId,
+		SessionID:   sessionID,
+		TokenUse:    TokenUseRefresh,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        bson.NewObjectID().Hex(),
 			Issuer:    "Gotrock",
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * 7 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(RefreshTokenLifetime)),
 		},
 	}
 	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
@@ -61,50 +90,95 @@ func GenerateAllTokens(email, firstName, lastName, userId string, role models.Us
 	return signedToken, signedRefreshToken, nil
 }
 
-var userCollection *mongo.Collection = database.OpenCollection("users")
-
-func UpdateAllTokens(userId, token, refreshToken string) (err error) {
-	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-	defer cancel()
-
-	updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-
-	updatedData := bson.M{
-		"$set": bson.M{
-			"token":         token,
-			"refresh_token": refreshToken,
-			"updated_at":    updatedAt,
+// GenerateImpersonationToken issues an access token that lets impersonatorId
+// act as userId until expiresAt. No refresh token is issued with it.
+func GenerateImpersonationToken(email, firstName, lastName, userId string, roles []models.UserRole, permissions []models.Permission, sessionID, impersonatorId string, expiresAt time.Time) (string, error) {
+	claims := &SignedDetails{
+		Email:          email,
+		FirstName:      firstName,
+		LastName:       lastName,
+		Role:           PrimaryRole(roles),
+		Roles:          roles,
+		Permissions:    permissions,
+		UserID:         userId,
+		SessionID:      sessionID,
+		TokenUse:       TokenUseImpersonation,
+		ImpersonatorID: impersonatorId,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        bson.NewObjectID().Hex(),
+			Issuer:    "Gotrock",
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 		},
 	}
-	_, err = userCollection.UpdateOne(ctx, bson.M{"user_id": userId}, updatedData)
-	if err != nil {
-		return err
+	return keyring.Sign(claims)
+}
+
+// GenerateChallengeToken issues the short-lived token a client trades,
+// together with a second factor, for a real token pair.
+func GenerateChallengeToken(userId string) (string, error) {
+	claims := &SignedDetails{
+		UserID:   userId,
+		TokenUse: TokenUseChallenge,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        bson.NewObjectID().Hex(),
+			Issuer:    "Gotrock",
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(5 * time.Minute)),
+		},
 	}
-	return nil
+	return keyring.Sign(claims)
 }
 
+var userCollection *mongo.Collection = database.OpenCollection("users")
+
 func GetAccessToken(ctx *gin.Context) (string, error) {
 	authHeader := ctx.Request.Header.Get("Authorization")
 	if authHeader == "" {
 		return "", errors.New("Authorization header is required")
 	}
-	token := authHeader[len("Bearer "):]
-	if token == "" {
+	token, ok := strings.CutPrefix(authHeader, "Bearer ")
+	if !ok || token == "" {
 		return "", errors.New("Bearer token is required")
 	}
 	return token, nil
 }
 
 func ValidateToken(tokenString string) (*SignedDetails, error) {
+	claims := &SignedDetails{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, keyring.Keyfunc)
+	if err != nil {
+		return nil, err
+	}
+	// tokens issued before TokenUse existed carry an empty value
+	switch claims.TokenUse {
+	case TokenUseAccess, "":
+	case TokenUseImpersonation:
+		if claims.ImpersonatorID == "" {
+			return nil, errors.New("Impersonation token without impersonator")
+		}
+	default:
+		return nil, errors.New("Not an access token")
+	}
+	if claims.ExpiresAt.Time.Before(time.Now()) {
+		return nil, errors.New("Token has expired")
+	}
+	return claims, nil
+}
+
+func ValidateRefreshToken(tokenString string) (*SignedDetails, error) {
 	claims := &SignedDetails{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (any, error) {
-		return []byte(config.Env.SECRET_ACCESS_KEY), nil
+		return []byte(config.Env.SECRET_REFRESH_KEY), nil
 	})
 	if err != nil {
 		return nil, err
 	}
 	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-		return nil, err
+		return nil, errors.New("Unexpected signing method")
+	}
+	if claims.TokenUse != TokenUseRefresh && claims.TokenUse != "" {
+		return nil, errors.New("Not a refresh token")
 	}
 	if claims.ExpiresAt.Time.Before(time.Now()) {
 		return nil, errors.New("Token has expired")
@@ -112,6 +186,18 @@ func ValidateToken(tokenString string) (*SignedDetails, error) {
 	return claims, nil
 }
 
+func ValidateChallengeToken(tokenString string) (*SignedDetails, error) {
+	claims := &SignedDetails{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, keyring.Keyfunc)
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenUse != TokenUseChallenge {
+		return nil, errors.New("Not a challenge token")
+	}
+	return claims, nil
+}
+
 func GetUserIDFromContext(ctx *gin.Context) (string, error) {
 	userId, exists := ctx.Get("userId")
 	if !exists {
@@ -124,6 +210,42 @@ func GetUserIDFromContext(ctx *gin.Context) (string, error) {
 	return id, nil
 }
 
+func GetClaimsFromContext(ctx *gin.Context) (*SignedDetails, error) {
+	value, exists := ctx.Get("claims")
+	if !exists {
+		return nil, errors.New("Token claims do not exist in this context")
+	}
+	claims, ok := value.(*SignedDetails)
+	if !ok {
+		return nil, errors.New("Unable to retrieve token claims")
+	}
+	return claims, nil
+}
+
+func GetUserRolesFromContext(ctx *gin.Context) ([]models.UserRole, error) {
+	roles, exists := ctx.Get("roles")
+	if !exists {
+		return nil, errors.New("User roles do not exist in this context")
+	}
+	userRoles, ok := roles.([]models.UserRole)
+	if !ok {
+		return nil, errors.New("Unable to retrieve user roles")
+	}
+	return userRoles, nil
+}
+
+func GetPermissionsFromContext(ctx *gin.Context) ([]models.Permission, error) {
+	permissions, exists := ctx.Get("permissions")
+	if !exists {
+		return nil, errors.New("Permissions do not exist in this context")
+	}
+	granted, ok := permissions.([]models.Permission)
+	if !ok {
+		return nil, errors.New("Unable to retrieve permissions")
+	}
+	return granted, nil
+}
+
 func GetUserRoleFromContext(ctx *gin.Context) (models.UserRole, error) {
 	role, exists := ctx.Get("role")
 	if !exists {
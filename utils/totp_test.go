@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// the SHA-1 seed of RFC 6238 Appendix B, "12345678901234567890"
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+// RFC 6238 Appendix B lists 8 digit codes; 6 digit codes are their last six
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	for _, vector := range rfc6238Vectors {
+		if got := totpCode([]byte("12345678901234567890"), vector.unix/totpPeriod); got != vector.code {
+			t.Errorf("code at %d = %s, want %s", vector.unix, got, vector.code)
+		}
+		step, ok := ValidateTOTP(rfc6238Secret, vector.code, 0, time.Unix(vector.unix, 0))
+		if !ok || step != vector.unix/totpPeriod {
+			t.Errorf("ValidateTOTP at %d = %d, %v", vector.unix, step, ok)
+		}
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / totpPeriod
+	key, _ := totpEncoding.DecodeString(rfc6238Secret)
+	for offset := int64(-3); offset <= 3; offset++ {
+		step, ok := ValidateTOTP(rfc6238Secret, totpCode(key, current+offset), 0, now)
+		want := offset >= -totpSkew && offset <= totpSkew
+		if ok != want {
+			t.Errorf("code %d steps from now accepted = %v, want %v", offset, ok, want)
+		}
+		if ok && step != current+offset {
+			t.Errorf("code %d steps from now matched step %d", offset, step-current)
+		}
+	}
+}
+
+func TestValidateTOTPRefusesReplays(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / totpPeriod
+	key, _ := totpEncoding.DecodeString(rfc6238Secret)
+	code := totpCode(key, current)
+	step, ok := ValidateTOTP(rfc6238Secret, code, current-1, now)
+	if !ok || step != current {
+		t.Fatal("fresh code refused")
+	}
+	// once its step or a later one is recorded the code is used up
+	for _, lastUsedStep := range []int64{current, current + 1} {
+		if _, ok := ValidateTOTP(rfc6238Secret, code, lastUsedStep, now); ok {
+			t.Errorf("code accepted again with last used step %d", lastUsedStep-current)
+		}
+	}
+	// an older code inside the window is refused once a newer one was used
+	if _, ok := ValidateTOTP(rfc6238Secret, totpCode(key, current-1), current, now); ok {
+		t.Error("older code accepted after a newer one was used")
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, totpCode(key, current+1), current, now); !ok {
+		t.Error("next code refused")
+	}
+}
+
+func TestValidateTOTPRejectsMalformedInput(t *testing.T) {
+	now := time.Unix(59, 0)
+	for _, tt := range []struct{ secret, code string }{
+		{rfc6238Secret, "28708"},
+		{rfc6238Secret, "2870820"},
+		{rfc6238Secret, "94287082"},
+		{"not base32!", "287082"},
+	} {
+		if _, ok := ValidateTOTP(tt.secret, tt.code, 0, now); ok {
+			t.Errorf("ValidateTOTP(%q, %q) accepted", tt.secret, tt.code)
+		}
+	}
+	// secrets are accepted in lower case and with surrounding space
+	if _, ok := ValidateTOTP(" "+strings.ToLower(rfc6238Secret)+" ", "287082", 0, now); !ok {
+		t.Error("lower case secret refused")
+	}
+}